@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// maxBatchOperations is the most operations a single batch can hold.
+const maxBatchOperations = 100
+
+// errBatchFailed is returned inside the batch transaction when one of the operations
+// failed, to have the transaction rolled back.
+var errBatchFailed = errors.New("batch operation failed")
+
+// batchOperation is one of the changes in a batch. A create needs the movie, a patch
+// needs the id, the version the client last saw and the fields of the movie to
+// change, and a delete needs the id, and optionally the version.
+type batchOperation struct {
+	Op string `json:"op"`
+	ID int64 `json:"id"`
+	Version *int32 `json:"version"`
+	Movie *struct {
+		Title *string `json:"title"`
+		Year *int32 `json:"year"`
+		Runtime *data.Runtime `json:"runtime"`
+		Genres []string `json:"genres"`
+	} `json:"movie"`
+}
+
+// batchResult reports what happened to one operation, with the status code it would
+// have been given as a request of its own.
+type batchResult struct {
+	Op string `json:"op"`
+	Status int `json:"status"`
+	Movie *data.Movie `json:"movie,omitempty"`
+	Error interface{} `json:"error,omitempty"`
+}
+
+// MarshalXML renders the result with one child element per field. The error can be a
+// map of validation errors, which encoding/xml can't handle on its own.
+func (res batchResult) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	fields := map[string]interface{}{"op": res.Op, "status": res.Status}
+	if res.Movie != nil {
+		fields["movie"] = res.Movie
+	}
+	if res.Error != nil {
+		fields["error"] = res.Error
+	}
+
+	return encodeXMLValue(enc, start, fields)
+}
+
+// The batchMoviesHandler() makes a list of changes to movies in one database
+// transaction, so that either all of them are made or none are. The response holds
+// one result per operation, in the same order. If any operation fails, the response
+// takes the status code of the first failure, and the operations that would have
+// succeeded are reported with 424 Failed Dependency, since they were rolled back.
+func (app *application) batchMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least 1 operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+
+	for i, op := range input.Operations {
+		key := fmt.Sprintf("operations[%d]", i)
+
+		switch op.Op {
+		case "create":
+			v.Check(op.Movie != nil, key, "must include the movie to create")
+		case "patch":
+			v.Check(op.ID > 0, key, "must include the id of the movie to patch")
+			v.Check(op.Version != nil, key, "must include the version of the movie to patch")
+			v.Check(op.Movie != nil, key, "must include the fields of the movie to change")
+		case "delete":
+			v.Check(op.ID > 0, key, "must include the id of the movie to delete")
+		default:
+			v.AddError(key, "op must be one of create, patch or delete")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	vocab, err := app.genreVocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	results := make([]batchResult, len(input.Operations))
+
+	err = data.RunInTx(app.models.Movie.DB, func(tx *sql.Tx) error {
+		movies := app.movieModel(r).WithTx(tx)
+		failed := false
+
+		// Operations that fail on their own terms don't stop the rest from running, so
+		// that the client hears about every problem in the batch at once. An error from
+		// the database does, as the transaction can't be used after one.
+		for i, op := range input.Operations {
+			result, err := app.runBatchOperation(movies, vocab, op)
+			if err != nil {
+				return err
+			}
+
+			results[i] = result
+			if result.Error != nil {
+				failed = true
+			}
+		}
+
+		if failed {
+			return errBatchFailed
+		}
+
+		return nil
+	})
+
+	status := http.StatusOK
+
+	switch {
+	case errors.Is(err, errBatchFailed):
+		status = 0
+		for i := range results {
+			switch {
+			case results[i].Error != nil && status == 0:
+				status = results[i].Status
+			case results[i].Error == nil:
+				results[i] = batchResult{
+					Op: results[i].Op,
+					Status: http.StatusFailedDependency,
+					Error: "not applied because another operation in the batch failed",
+				}
+			}
+		}
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render(w, r, status, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runBatchOperation carries out one operation of a batch using the given model,
+// which runs inside the batch's transaction. Failures of the operation itself, such
+// as a validation error or an edit conflict, are reported in the result; the error
+// returned is for anything else.
+func (app *application) runBatchOperation(movies data.MovieModel, vocab data.GenreVocabulary, op batchOperation) (batchResult, error) {
+	result := batchResult{Op: op.Op}
+
+	fail := func(status int, message interface{}) (batchResult, error) {
+		result.Status = status
+		result.Error = message
+		return result, nil
+	}
+
+	var movie *data.Movie
+
+	switch op.Op {
+	case "create":
+		movie = &data.Movie{}
+	case "patch", "delete":
+		var err error
+		movie, err = movies.Get(op.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return fail(http.StatusNotFound, "the requested resource could not be found")
+			default:
+				return result, err
+			}
+		}
+
+		if op.Version != nil && *op.Version != movie.Version {
+			return fail(http.StatusConflict, "unable to update the record due to an edit conflict, please try again")
+		}
+	}
+
+	if op.Op == "delete" {
+		err := movies.Delete(op.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return fail(http.StatusNotFound, "the requested resource could not be found")
+			default:
+				return result, err
+			}
+		}
+
+		result.Status = http.StatusOK
+		return result, nil
+	}
+
+	if op.Movie.Title != nil {
+		movie.Title = *op.Movie.Title
+	}
+	if op.Movie.Year != nil {
+		movie.Year = *op.Movie.Year
+	}
+	if op.Movie.Runtime != nil {
+		movie.Runtime = *op.Movie.Runtime
+	}
+	if op.Movie.Genres != nil {
+		movie.Genres = op.Movie.Genres
+	}
+
+	v := validator.New()
+	data.ValidateMovieGenres(v, vocab, movie)
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return fail(http.StatusUnprocessableEntity, v.Errors)
+	}
+
+	var err error
+	if op.Op == "create" {
+		err = movies.Insert(movie)
+		result.Status = http.StatusCreated
+	} else {
+		err = movies.Update(movie)
+		result.Status = http.StatusOK
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return fail(http.StatusConflict, "unable to update the record due to an edit conflict, please try again")
+		default:
+			return result, err
+		}
+	}
+
+	result.Movie = movie
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+type batchResponse struct {
+	Results []struct {
+		Op string `json:"op"`
+		Status int `json:"status"`
+		Movie *data.Movie `json:"movie"`
+		Error interface{} `json:"error"`
+	} `json:"results"`
+}
+
+func (resp batchResponse) statuses() []int {
+	statuses := []int{}
+	for _, result := range resp.Results {
+		statuses = append(statuses, result.Status)
+	}
+	return statuses
+}
+
+func TestBatchMovies(t *testing.T) {
+	app := newTestApplication(t)
+
+	ids := insertMovies(t, app,
+		&data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "drama"}},
+		&data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+	)
+
+	send := func(body string) (int, batchResponse) {
+		t.Helper()
+
+		var resp batchResponse
+		status := sendJSON(t, app, app.batchMoviesHandler, http.MethodPost, "/v1/movies/batch", body, &resp)
+		return status, resp
+	}
+
+	title := func(id int64) string {
+		t.Helper()
+
+		movie, err := app.models.Movie.Get(id)
+		if err != nil {
+			t.Fatalf("getting movie %d: %v", id, err)
+		}
+		return movie.Title
+	}
+
+	t.Run("patch a movie created earlier in the batch", func(t *testing.T) {
+		// The schema is new, so the movie created first gets the id after the ones
+		// inserted above. The patch has to see it inside the batch's transaction.
+		created := ids["Alien"] + 1
+
+		status, resp := send(fmt.Sprintf(`{"operations": [
+			{"op": "create", "movie": {"title": "Toy Story", "year": 1995, "runtime": "81 mins", "genres": ["animation"]}},
+			{"op": "patch", "id": %d, "version": 1, "movie": {"title": "Toy Story 2", "year": 1999}}
+		]}`, created))
+
+		if status != http.StatusOK {
+			t.Fatalf("got status %d and results %v; want 200", status, resp.statuses())
+		}
+		if resp.Results[0].Movie.ID != created || resp.Results[1].Movie.Title != "Toy Story 2" || resp.Results[1].Movie.Version != 2 {
+			t.Errorf("got results %+v, %+v; want the movie created and then patched", resp.Results[0].Movie, resp.Results[1].Movie)
+		}
+		if got := title(created); got != "Toy Story 2" {
+			t.Errorf("got stored title %q; want Toy Story 2", got)
+		}
+	})
+
+	t.Run("a failed operation rolls back the others", func(t *testing.T) {
+		status, resp := send(fmt.Sprintf(`{"operations": [
+			{"op": "patch", "id": %d, "version": 1, "movie": {"title": "Heat (1995)"}},
+			{"op": "create", "movie": {"title": "Up", "year": 2009, "runtime": "96 mins", "genres": ["animation"]}},
+			{"op": "delete", "id": 999},
+			{"op": "create", "movie": {"title": "", "year": 2009, "runtime": "96 mins", "genres": ["animation"]}}
+		]}`, ids["Heat"]))
+
+		if status != http.StatusNotFound {
+			t.Errorf("got status %d; want 404, from the first failure", status)
+		}
+
+		want := []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusNotFound, http.StatusUnprocessableEntity}
+		if got := resp.statuses(); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got statuses %v; want %v", got, want)
+		}
+
+		if got := title(ids["Heat"]); got != "Heat" {
+			t.Errorf("got stored title %q; want the patch rolled back", got)
+		}
+
+		_, metadata, err := app.models.Movie.GetAll(data.MovieFilter{Title: "up"}, data.Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.TotalRecords != 0 {
+			t.Errorf("got %d movies titled Up; want the create rolled back", metadata.TotalRecords)
+		}
+	})
+
+	t.Run("a version conflict", func(t *testing.T) {
+		status, resp := send(fmt.Sprintf(`{"operations": [
+			{"op": "patch", "id": %d, "version": 7, "movie": {"title": "Alien 3"}}
+		]}`, ids["Alien"]))
+
+		if status != http.StatusConflict || len(resp.Results) != 1 || resp.Results[0].Status != http.StatusConflict {
+			t.Errorf("got status %d and results %v; want 409", status, resp.statuses())
+		}
+		if got := title(ids["Alien"]); got != "Alien" {
+			t.Errorf("got stored title %q; want it unchanged", got)
+		}
+	})
+}
+
+func TestBatchMoviesValidation(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		body string
+		key string
+		want string
+	}{
+		{`{"operations": []}`, "operations", "must contain at least 1 operation"},
+		{`{"operations": [{"op": "rename"}]}`, "operations[0]", "op must be one of create, patch or delete"},
+		{`{"operations": [{"op": "delete"}, {"op": "patch", "id": 1, "movie": {}}]}`, "operations[1]", "must include the version of the movie to patch"},
+		{`{"operations": [{"op": "create"}]}`, "operations[0]", "must include the movie to create"},
+	}
+
+	for _, tt := range tests {
+		var resp struct {
+			Error map[string]string `json:"error"`
+		}
+
+		status := sendJSON(t, app, app.batchMoviesHandler, http.MethodPost, "/v1/movies/batch", tt.body, &resp)
+
+		if status != http.StatusUnprocessableEntity || resp.Error[tt.key] != tt.want {
+			t.Errorf("%s: got status %d and errors %v; want 422 with %s %q", tt.body, status, resp.Error, tt.key, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// The batchGetMoviesHandler() fetches a list of movies by id in one request, for
+// clients that would otherwise have to request them one at a time. The ids go in the
+// request body, so that there's room for long lists, along with the fields to narrow
+// the movies down to, which work as they do on the listing.
+func (app *application) batchGetMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+		Fields []string `json:"fields"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.batchGetMovies(w, r, input.IDs, input.Fields, validator.New())
+}
+
+// batchGetMovies sends the movies with the given ids, in the order they were asked
+// for. Ids that don't belong to a movie are listed separately under not_found, rather
+// than failing the whole request. Any errors already recorded in the validator are
+// reported along with those found in the ids and fields.
+func (app *application) batchGetMovies(w http.ResponseWriter, r *http.Request, ids []int64, fields []string, v *validator.Validator) {
+	data.ValidateMovieIDs(v, ids)
+
+	if data.ValidateFields(v, fields, movieFieldSafelist); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.models.Movie.GetMany(ids, fields...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	found := make(map[int64]bool, len(movies))
+	for _, movie := range movies {
+		found[movie.ID] = true
+	}
+
+	notFound := []int64{}
+	for _, id := range ids {
+		if !found[id] {
+			notFound = append(notFound, id)
+		}
+	}
+
+	env := envelope{"movies": movies, "not_found": notFound}
+
+	if len(fields) > 0 {
+		env["movies"] = sparseMovies(movies, fields)
+	}
+
+	err = app.render(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
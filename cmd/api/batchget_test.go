@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+func TestBatchGetMovies(t *testing.T) {
+	app := newTestApplication(t)
+
+	ids := insertMovies(t, app,
+		&data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "drama"}},
+		&data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+		&data.Movie{Title: "Toy Story", Year: 1995, Runtime: 81, Genres: []string{"animation", "comedy"}},
+	)
+
+	if err := app.models.Movie.Delete(ids["Toy Story"]); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp struct {
+		Movies []data.Movie `json:"movies"`
+		NotFound []int64 `json:"not_found"`
+	}
+
+	// The movies come back in the order they were asked for, and the ids of missing
+	// and trashed movies are listed separately.
+	body := fmt.Sprintf(`{"ids": [%d, 999, %d, %d]}`, ids["Alien"], ids["Heat"], ids["Toy Story"])
+	status := sendJSON(t, app, app.batchGetMoviesHandler, http.MethodPost, "/v1/movies/batch-get", body, &resp)
+
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want 200", status)
+	}
+
+	var titles []string
+	for _, movie := range resp.Movies {
+		titles = append(titles, movie.Title)
+	}
+	if want := []string{"Alien", "Heat"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("got movies %q; want %q", titles, want)
+	}
+	if want := []int64{999, ids["Toy Story"]}; !reflect.DeepEqual(resp.NotFound, want) {
+		t.Errorf("got not_found %v; want %v", resp.NotFound, want)
+	}
+
+	// The fields narrow the movies down as they do on the listing.
+	var sparse struct {
+		Movies []map[string]interface{} `json:"movies"`
+	}
+	body = fmt.Sprintf(`{"ids": [%d], "fields": ["title"]}`, ids["Heat"])
+	sendJSON(t, app, app.batchGetMoviesHandler, http.MethodPost, "/v1/movies/batch-get", body, &sparse)
+
+	if want := []map[string]interface{}{{"title": "Heat"}}; !reflect.DeepEqual(sparse.Movies, want) {
+		t.Errorf("got sparse movies %v; want %v", sparse.Movies, want)
+	}
+
+	// The same lookup is available on the listing with an ids parameter.
+	target := fmt.Sprintf("/v1/movies?ids=%d,%d", ids["Heat"], ids["Alien"])
+	sendJSON(t, app, app.listMoviesHandler, http.MethodGet, target, "", &resp)
+
+	titles = nil
+	for _, movie := range resp.Movies {
+		titles = append(titles, movie.Title)
+	}
+	if want := []string{"Heat", "Alien"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("listing by ids: got movies %q; want %q", titles, want)
+	}
+}
+
+func TestBatchGetMoviesValidation(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"ids": []}`, "must contain at least 1 id"},
+		{`{"ids": [1, 1]}`, "must not contain duplicate values"},
+		{`{"ids": [0]}`, "must only contain positive integers"},
+		{`{"ids": [1], "fields": ["plot"]}`, `invalid field "plot"`},
+	}
+
+	for _, tt := range tests {
+		var resp struct {
+			Error map[string]string `json:"error"`
+		}
+
+		status := sendJSON(t, app, app.batchGetMoviesHandler, http.MethodPost, "/v1/movies/batch-get", tt.body, &resp)
+
+		if status != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got status %d; want 422", tt.body, status)
+		}
+		if got := resp.Error["ids"] + resp.Error["fields"]; got != tt.want {
+			t.Errorf("%s: got error %q; want %q", tt.body, got, tt.want)
+		}
+	}
+}
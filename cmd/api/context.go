@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+// The contextSetUser() method returns a new copy of the request with the provided
+// User struct added to the context.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// The contextGetUser() retrieves the User struct from the request context. The only
+// time that we'll use this helper is when we logically expect there to be a User
+// struct value in the context, and if it doesn't exist it will firmly be an
+// 'unexpected' error, so it's OK to panic.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
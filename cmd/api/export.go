@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// movieEncoder writes an export in one of the supported formats. begin() and end()
+// write whatever has to surround the rows, and encode() writes a single row.
+type movieEncoder interface {
+	begin() error
+	encode(movie *data.Movie) error
+	end() error
+}
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.MovieFilter
+		Format string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.MovieFilter = app.readMovieFilter(qs, v)
+	input.Format = app.readString(qs, "format", "ndjson")
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = movieSortSafelist
+
+	v.Check(validator.In(input.Format, "ndjson", "csv", "json"), "format", "must be one of ndjson, csv or json")
+	data.ValidateSort(v, input.Filters)
+
+	data.ValidateMovieFilter(v, input.MovieFilter, input.Filters)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.canonicalMovieFilter(&input.MovieFilter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var enc movieEncoder
+	var contentType string
+
+	switch input.Format {
+	case "ndjson":
+		enc, contentType = &ndjsonMovieEncoder{w: w}, "application/x-ndjson"
+	case "csv":
+		enc, contentType = &csvMovieEncoder{w: csv.NewWriter(w)}, "text/csv"
+	default:
+		enc, contentType = &jsonMovieEncoder{w: w}, "application/json"
+	}
+
+	rc := http.NewResponseController(w)
+
+	// Nothing is sent until the first row arrives, so that an error from the database
+	// before then can still be reported with a proper error response.
+	started := false
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="movies.`+input.Format+`"`)
+		w.WriteHeader(http.StatusOK)
+
+		return enc.begin()
+	}
+
+	rows := 0
+
+	err = app.models.Movie.Export(r.Context(), input.MovieFilter, input.Filters, func(movie *data.Movie) error {
+		if err := start(); err != nil {
+			return err
+		}
+
+		if err := enc.encode(movie); err != nil {
+			return err
+		}
+
+		// Push what we have to the client every so often, and push the write deadline
+		// back so that the server's WriteTimeout doesn't cut off a long export.
+		rows++
+		if rows%100 == 0 {
+			rc.SetWriteDeadline(time.Now().Add(30 * time.Second))
+			return rc.Flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The status code has already gone out, so all we can do is log the error and
+		// stop. The client will see a truncated body.
+		app.logError(r, err)
+		return
+	}
+
+	if err := start(); err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	if err := enc.end(); err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	rc.Flush()
+}
+
+type ndjsonMovieEncoder struct {
+	w io.Writer
+}
+
+func (e *ndjsonMovieEncoder) begin() error {
+	return nil
+}
+
+func (e *ndjsonMovieEncoder) encode(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(append(js, '\n'))
+	return err
+}
+
+func (e *ndjsonMovieEncoder) end() error {
+	return nil
+}
+
+// jsonMovieEncoder writes a single JSON document in the same {"movies": [...]}
+// envelope used by the list endpoint.
+type jsonMovieEncoder struct {
+	w io.Writer
+	count int
+}
+
+func (e *jsonMovieEncoder) begin() error {
+	_, err := io.WriteString(e.w, `{"movies":[`)
+	return err
+}
+
+func (e *jsonMovieEncoder) encode(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		js = append([]byte{','}, js...)
+	}
+	e.count++
+
+	_, err = e.w.Write(append(js, '\n'))
+	return err
+}
+
+func (e *jsonMovieEncoder) end() error {
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
+
+// csvMovieEncoder writes a header line followed by one line per movie. The genres go
+// in a single field separated by commas, which is the format the import endpoint
+// reads them in.
+type csvMovieEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvMovieEncoder) begin() error {
+	return e.w.Write([]string{"id", "title", "year", "runtime", "genres", "version"})
+}
+
+func (e *csvMovieEncoder) encode(movie *data.Movie) error {
+	err := e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		movie.Runtime.String(),
+		strings.Join(movie.Genres, ","),
+		strconv.FormatInt(int64(movie.Version), 10),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The csv.Writer has its own buffer, which needs flushing through to the
+	// ResponseWriter before the response itself can be flushed.
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvMovieEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
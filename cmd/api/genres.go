@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+// vocabularyCache holds the genre vocabulary, which is needed to validate every movie
+// that is created or changed and to filter listings by genre, but only changes when
+// the genres tables are edited. It is loaded again once the ttl has passed, which
+// bounds how long such an edit takes to be picked up.
+type vocabularyCache struct {
+	mu sync.Mutex
+	ttl time.Duration
+	vocab data.GenreVocabulary
+	expires time.Time
+}
+
+func newVocabularyCache(ttl time.Duration) *vocabularyCache {
+	return &vocabularyCache{ttl: ttl}
+}
+
+// get returns the cached vocabulary, calling load to load it if it has expired. The
+// vocabulary is shared, so callers must not change it.
+func (c *vocabularyCache) get(load func() (data.GenreVocabulary, error)) (data.GenreVocabulary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.vocab != nil && time.Now().Before(c.expires) {
+		return c.vocab, nil
+	}
+
+	vocab, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.vocab = vocab
+	c.expires = time.Now().Add(c.ttl)
+
+	return vocab, nil
+}
+
+// The genreVocabulary() helper returns the genre vocabulary from the cache.
+func (app *application) genreVocabulary() (data.GenreVocabulary, error) {
+	return app.vocabulary.get(app.models.Genre.Vocabulary)
+}
+
+// The listGenresHandler() lists the genre vocabulary, with the number of movies in
+// each genre.
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genre.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render(w, r, http.StatusOK, envelope{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The canonicalMovieFilter() helper turns the genres a listing is filtered by, in the
+// genres parameter and in the query, into their slugs, so that "Sci-Fi" finds the
+// movies stored as "sci-fi".
+func (app *application) canonicalMovieFilter(filter *data.MovieFilter) error {
+	hasGenreTerms := false
+	if filter.Query != nil {
+		for _, term := range filter.Query.Terms {
+			if _, ok := term.(data.GenreTerm); ok {
+				hasGenreTerms = true
+			}
+		}
+	}
+
+	if len(filter.Genres) == 0 && !hasGenreTerms {
+		return nil
+	}
+
+	vocab, err := app.genreVocabulary()
+	if err != nil {
+		return err
+	}
+
+	filter.Genres = vocab.Canonical(filter.Genres)
+	if filter.Query != nil {
+		filter.Query.CanonicalGenres(vocab)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+func TestVocabularyCache(t *testing.T) {
+	c := newVocabularyCache(time.Minute)
+
+	loads := 0
+	load := func() (data.GenreVocabulary, error) {
+		loads++
+		return data.GenreVocabulary{"drama": "drama"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		vocab, err := c.get(load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vocab["drama"] != "drama" {
+			t.Fatalf("got vocabulary %v", vocab)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("got %d loads within the ttl; want 1", loads)
+	}
+
+	// Once the ttl has passed the vocabulary is loaded again, and a failed load isn't
+	// cached.
+	c.expires = time.Now().Add(-time.Second)
+
+	failure := errors.New("database down")
+	if _, err := c.get(func() (data.GenreVocabulary, error) { return nil, failure }); err != failure {
+		t.Errorf("got error %v; want %v", err, failure)
+	}
+
+	if _, err := c.get(load); err != nil || loads != 2 {
+		t.Errorf("got %d loads, error %v after expiry; want 2 loads", loads, err)
+	}
+}
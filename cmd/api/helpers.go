@@ -9,7 +9,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Marsh-sudo/greenlight/internal/data"
 	"github.com/Marsh-sudo/greenlight/internal/validator"
 
 	"github.com/julienschmidt/httprouter"
@@ -27,6 +29,31 @@ func (app *application) readIDParam(r *http.Request) (int64,error) {
 	return id,nil
 }
 
+// The expectedVersionMatches() helper checks the optional X-Expected-Version request
+// header against the movie's current version. Clients send it to make sure they are
+// changing the version of the movie they last saw. If the header isn't set there's
+// nothing to check.
+func (app *application) expectedVersionMatches(r *http.Request, movie *data.Movie) bool {
+	expected := r.Header.Get("X-Expected-Version")
+	if expected == "" {
+		return true
+	}
+
+	return strconv.FormatInt(int64(movie.Version), 10) == expected
+}
+
+// The movieModel() helper returns the movie model with the user making the request set
+// as the actor, so that the revisions made by their changes record who made them.
+// Changes made by anonymous clients have no actor.
+func (app *application) movieModel(r *http.Request) data.MovieModel {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return app.models.Movie
+	}
+
+	return app.models.Movie.WithActor(strconv.FormatInt(user.ID, 10))
+}
+
 func (app *application) writeJSON(w http.ResponseWriter,status int,data envelope,headers http.Header) error {
 	js, err := json.MarshalIndent(data,"","\t")
 	if err != nil {
@@ -44,9 +71,12 @@ func (app *application) writeJSON(w http.ResponseWriter,status int,data envelope
 	return nil
 }
 
+// maxJSONBytes is the largest request body readJSON() accepts.
+const maxJSONBytes = 1_048_576
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request,dst interface{}) error {
 	// decode the request body into the target dest.
-	maxBytes := 1_048_576
+	maxBytes := maxJSONBytes
 	r.Body = http.MaxBytesReader(w,r.Body,int64(maxBytes))
 
 	dec := json.NewDecoder(r.Body)
@@ -146,4 +176,160 @@ func (app *application) readInt(qs url.Values,key string, defaultValue int,v *va
 	}
 
 	return i
-}
\ No newline at end of file
+}
+
+// The readIDs() helper reads a comma-separated list of ids from the query string. If
+// any of them isn't an integer it records an error message in the provided Validator
+// instance. An empty value gives an empty list.
+func (app *application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	ids := []int64{}
+
+	for _, s := range app.readCSV(qs, key, []string{}) {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			v.AddError(key, "must be a comma-separated list of integers")
+			return []int64{}
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// The readTime() helper reads an RFC 3339 timestamp from the query string. It returns
+// nil if no matching key could be found, and records an error message in the provided
+// Validator instance if the value couldn't be parsed.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp, e.g. 2006-01-02T15:04:05Z")
+		return nil
+	}
+
+	return &t
+}
+
+// The readBool() helper reads a boolean value from the query string, accepting the
+// values strconv.ParseBool() does. If no matching key could be found it returns the
+// provided default value, and if the value couldn't be parsed it records an error
+// message in the provided Validator instance.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+
+	return b
+}
+
+// The readRuntime() helper reads a runtime from the query string, written either as
+// "<runtime> mins" or as a plain number of minutes. It returns 0 if no matching key
+// could be found, and records an error message in the provided Validator instance if
+// the value couldn't be parsed.
+func (app *application) readRuntime(qs url.Values, key string, v *validator.Validator) data.Runtime {
+	s := qs.Get(key)
+
+	if s == "" {
+		return 0
+	}
+
+	runtime, err := data.ParseRuntime(s)
+	if err != nil {
+		v.AddError(key, `must be a number of minutes, e.g. 90 or "90 mins"`)
+		return 0
+	}
+
+	return runtime
+}
+
+// The readMovieFilter() helper reads the query string parameters the movie listings
+// can be filtered by. The q parameter holds a search query (see data.MovieQuery), any
+// mistakes in which are recorded in the provided Validator instance.
+func (app *application) readMovieFilter(qs url.Values, v *validator.Validator) data.MovieFilter {
+	var query *data.MovieQuery
+	if q := qs.Get("q"); q != "" {
+		query = data.ParseMovieQuery(v, "q", q)
+	}
+
+	return data.MovieFilter{
+		Title: app.readString(qs, "title", ""),
+		FuzzyTitle: app.readBool(qs, "fuzzy", false, v),
+		Genres: app.readCSV(qs, "genres", []string{}),
+		AnyGenres: app.readBool(qs, "any_genres", false, v),
+		YearMin: int32(app.readInt(qs, "year_min", 0, v)),
+		YearMax: int32(app.readInt(qs, "year_max", 0, v)),
+		RuntimeMin: app.readRuntime(qs, "runtime_min", v),
+		RuntimeMax: app.readRuntime(qs, "runtime_max", v),
+		Query: query,
+	}
+}
+
+// The paginationHeaders() helper returns the headers describing a page of a listing:
+// an RFC 8288 Link header pointing at the first, previous, next and last pages, as far
+// as they are known, and an X-Total-Count header when the records were counted. An
+// estimated total is sent as X-Estimated-Total-Count instead, so that clients relying
+// on X-Total-Count are never handed a guess. The links keep all of the request's query string parameters apart from the ones that
+// select the page. A listing paged with a cursor can only link onwards to the next
+// page, or back to the first.
+func (app *application) paginationHeaders(r *http.Request, filters data.Filters, metadata data.Metadata) http.Header {
+	var links []string
+
+	link := func(rel string, key string, value string) {
+		qs := r.URL.Query()
+		qs.Del("page")
+		qs.Del("cursor")
+		if key != "" {
+			qs.Set(key, value)
+		}
+
+		u := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel))
+	}
+
+	headers := http.Header{}
+
+	if filters.Cursor != "" {
+		link("first", "", "")
+		if metadata.NextCursor != "" {
+			link("next", "cursor", metadata.NextCursor)
+		}
+	} else {
+		link("first", "page", "1")
+		if metadata.PrevPage > 0 {
+			link("prev", "page", strconv.Itoa(metadata.PrevPage))
+		}
+		if metadata.NextPage > 0 {
+			link("next", "page", strconv.Itoa(metadata.NextPage))
+		}
+		if metadata.LastPage > 0 {
+			link("last", "page", strconv.Itoa(metadata.LastPage))
+		}
+
+		switch {
+		case filters.Count == "estimated":
+			if metadata.Estimated {
+				headers.Set("X-Estimated-Total-Count", strconv.Itoa(metadata.TotalRecords))
+			}
+		case filters.Count != "none":
+			headers.Set("X-Total-Count", strconv.Itoa(metadata.TotalRecords))
+		}
+	}
+
+	headers.Set("Link", strings.Join(links, ", "))
+
+	return headers
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+func TestPaginationHeaders(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name string
+		target string
+		filters data.Filters
+		metadata data.Metadata
+		wantLink string
+		wantTotal string
+		wantEstimate string
+	}{
+		{
+			name: "middle page",
+			target: "/v1/movies?genres=drama&page=2&page_size=5",
+			filters: data.Filters{Page: 2, PageSize: 5},
+			metadata: data.Metadata{CurrentPage: 2, PageSize: 5, FirstPage: 1, LastPage: 3, TotalRecords: 12, PrevPage: 1, NextPage: 3},
+			wantLink: `</v1/movies?genres=drama&page=1&page_size=5>; rel="first", ` +
+				`</v1/movies?genres=drama&page=1&page_size=5>; rel="prev", ` +
+				`</v1/movies?genres=drama&page=3&page_size=5>; rel="next", ` +
+				`</v1/movies?genres=drama&page=3&page_size=5>; rel="last"`,
+			wantTotal: "12",
+		},
+		{
+			name: "only page",
+			target: "/v1/movies",
+			filters: data.Filters{Page: 1, PageSize: 20},
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 3},
+			wantLink: `</v1/movies?page=1>; rel="first", </v1/movies?page=1>; rel="last"`,
+			wantTotal: "3",
+		},
+		{
+			name: "no matches",
+			target: "/v1/movies?title=nothing",
+			filters: data.Filters{Page: 1, PageSize: 20},
+			metadata: data.Metadata{},
+			wantLink: `</v1/movies?page=1&title=nothing>; rel="first"`,
+			wantTotal: "0",
+		},
+		{
+			name: "not counted",
+			target: "/v1/movies?count=none",
+			filters: data.Filters{Page: 1, PageSize: 20, Count: "none"},
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 20, NextPage: 2},
+			wantLink: `</v1/movies?count=none&page=1>; rel="first", </v1/movies?count=none&page=2>; rel="next"`,
+		},
+		{
+			name: "estimated",
+			target: "/v1/movies?count=estimated",
+			filters: data.Filters{Page: 1, PageSize: 20, Count: "estimated"},
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 50, TotalRecords: 1000, Estimated: true, NextPage: 2},
+			wantLink: `</v1/movies?count=estimated&page=1>; rel="first", ` +
+				`</v1/movies?count=estimated&page=2>; rel="next", ` +
+				`</v1/movies?count=estimated&page=50>; rel="last"`,
+			wantEstimate: "1000",
+		},
+		{
+			name: "no estimate",
+			target: "/v1/movies?count=estimated",
+			filters: data.Filters{Page: 1, PageSize: 20, Count: "estimated"},
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1},
+			wantLink: `</v1/movies?count=estimated&page=1>; rel="first"`,
+		},
+		{
+			name: "cursor",
+			target: "/v1/movies?sort=-year&cursor=abc&page_size=2",
+			filters: data.Filters{PageSize: 2, Sort: "-year", Cursor: "abc"},
+			metadata: data.Metadata{PageSize: 2, NextCursor: "def"},
+			wantLink: `</v1/movies?page_size=2&sort=-year>; rel="first", </v1/movies?cursor=def&page_size=2&sort=-year>; rel="next"`,
+		},
+		{
+			name: "last cursor page",
+			target: "/v1/movies?cursor=abc",
+			filters: data.Filters{Cursor: "abc"},
+			metadata: data.Metadata{},
+			wantLink: `</v1/movies>; rel="first"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+
+			headers := app.paginationHeaders(r, tt.filters, tt.metadata)
+
+			if got := headers.Get("Link"); got != tt.wantLink {
+				t.Errorf("got Link %q; want %q", got, tt.wantLink)
+			}
+			if got := headers.Get("X-Total-Count"); got != tt.wantTotal {
+				t.Errorf("got X-Total-Count %q; want %q", got, tt.wantTotal)
+			}
+			if got := headers.Get("X-Estimated-Total-Count"); got != tt.wantEstimate {
+				t.Errorf("got X-Estimated-Total-Count %q; want %q", got, tt.wantEstimate)
+			}
+		})
+	}
+}
+
+func TestExpectedVersionMatches(t *testing.T) {
+	app := &application{}
+	movie := &data.Movie{Version: 12}
+
+	tests := []struct {
+		header string
+		want bool
+	}{
+		{"", true},
+		{"12", true},
+		{"11", false},
+		{"c", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("PUT", "/v1/movies/1", nil)
+		if tt.header != "" {
+			r.Header.Set("X-Expected-Version", tt.header)
+		}
+
+		if got := app.expectedVersionMatches(r, movie); got != tt.want {
+			t.Errorf("X-Expected-Version %q against version 12: got %t; want %t", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// importRow is a single movie read from an import body. The errors map holds any
+// problems found while decoding the row, before the movie is validated.
+type importRow struct {
+	line int
+	movie *data.Movie
+	errors map[string]string
+}
+
+// movieReader reads the rows of an import body one at a time, so that the body never
+// has to be held in memory. next() returns io.EOF once there are no rows left; any
+// other error means the body itself couldn't be read and the import must stop.
+type movieReader interface {
+	next() (*importRow, error)
+}
+
+// importReport is sent back to the client once an import is finished. Both maps are
+// keyed by the line number the row started on.
+type importReport struct {
+	Mode string `json:"mode"`
+	Rows int `json:"rows"`
+	Created map[int]int64 `json:"created"`
+	Errors map[int]map[string]string `json:"errors"`
+}
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	// The mode decides what happens when some rows fail: an atomic import stores
+	// nothing at all, a best_effort import stores every row that is valid.
+	mode := app.readString(r.URL.Query(), "mode", "atomic")
+	v.Check(validator.In(mode, "atomic", "best_effort"), "mode", "must be either atomic or best_effort")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	atomic := mode == "atomic"
+
+	// Imports are expected to be far larger than the bodies readJSON() deals with, so
+	// they get their own size limit and deadlines.
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.movieImport.maxBytes)
+	extendImportDeadlines(w)
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var reader movieReader
+	switch contentType {
+	case "application/x-ndjson", "application/ndjson":
+		reader = newNDJSONMovieReader(r.Body)
+	case "text/csv":
+		var err error
+		reader, err = newCSVMovieReader(r.Body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	default:
+		app.unsupportedMediaTypeResponse(w, r, contentType)
+		return
+	}
+
+	// The vocabulary is loaded once for the whole import.
+	vocab, err := app.genreVocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	imp, err := app.movieModel(r).NewImport(atomic)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer imp.Rollback()
+
+	report := importReport{
+		Mode: mode,
+		Created: map[int]int64{},
+		Errors: map[int]map[string]string{},
+	}
+
+	batch := make([]*data.Movie, 0, app.config.movieImport.batchSize)
+	lines := make([]int, 0, app.config.movieImport.batchSize)
+
+	flush := func() error {
+		defer func() {
+			batch = batch[:0]
+			lines = lines[:0]
+		}()
+
+		// Once an atomic import has a failed row nothing will be committed, so there's
+		// no point sending any more rows to the database.
+		if len(batch) == 0 || (atomic && len(report.Errors) > 0) {
+			return nil
+		}
+
+		err := imp.Insert(batch)
+		if err == nil {
+			for i, movie := range batch {
+				report.Created[lines[i]] = movie.ID
+			}
+			return nil
+		}
+
+		if atomic {
+			return err
+		}
+
+		// A best effort batch is retried one row at a time, so that a single row the
+		// database refuses doesn't take the rest of its batch down with it.
+		for i, movie := range batch {
+			err := imp.Insert([]*data.Movie{movie})
+			if err != nil {
+				app.logError(r, err)
+				report.Errors[lines[i]] = map[string]string{"row": "could not be saved"}
+				continue
+			}
+			report.Created[lines[i]] = movie.ID
+		}
+
+		return nil
+	}
+
+	for {
+		row, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			app.importAbortedResponse(w, r, err, report, atomic)
+			return
+		}
+
+		report.Rows++
+
+		v := validator.New()
+		for key, message := range row.errors {
+			v.AddError(key, message)
+		}
+		if row.movie != nil {
+			data.ValidateMovieGenres(v, vocab, row.movie)
+			data.ValidateMovie(v, row.movie)
+		}
+
+		if !v.Valid() {
+			report.Errors[row.line] = v.Errors
+			continue
+		}
+
+		batch = append(batch, row.movie)
+		lines = append(lines, row.line)
+
+		if len(batch) == app.config.movieImport.batchSize {
+			if err := flush(); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+
+	if len(report.Errors) > 0 {
+		status = http.StatusOK
+
+		if atomic {
+			report.Created = map[int]int64{}
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	if atomic && len(report.Errors) == 0 {
+		if err := imp.Commit(); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, status, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importAbortedResponse is sent when the import body can't be read to the end. Rows
+// from a best effort import that were already stored stay stored, so the report is
+// included to tell the client which ones they were.
+func (app *application) importAbortedResponse(w http.ResponseWriter, r *http.Request, err error, report importReport, atomic bool) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+	}
+
+	if atomic {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusBadRequest, envelope{"error": err.Error(), "import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ndjsonMovieReader reads newline-delimited JSON, one movie object per line.
+type ndjsonMovieReader struct {
+	r *bufio.Reader
+	line int
+}
+
+func newNDJSONMovieReader(r io.Reader) *ndjsonMovieReader {
+	return &ndjsonMovieReader{r: bufio.NewReader(r)}
+}
+
+func (nr *ndjsonMovieReader) next() (*importRow, error) {
+	for {
+		b, err := nr.r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(b)) == 0 {
+			// Blank lines are skipped, but still counted so that line numbers in the
+			// report match the client's file.
+			if err != nil {
+				return nil, io.EOF
+			}
+			nr.line++
+			continue
+		}
+
+		nr.line++
+		return decodeNDJSONRow(nr.line, b), nil
+	}
+}
+
+func decodeNDJSONRow(line int, b []byte) *importRow {
+	var input struct {
+		Title string `json:"title"`
+		Year int32 `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres []string `json:"genres"`
+	}
+
+	row := &importRow{line: line}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&input)
+	if err == nil && dec.More() {
+		err = errors.New("line must only contain a single JSON value")
+	}
+
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		message := err.Error()
+
+		switch {
+		case errors.As(err, &syntaxError), errors.Is(err, io.ErrUnexpectedEOF):
+			message = "contains badly-formed JSON"
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			message = fmt.Sprintf("contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			row.errors = map[string]string{"runtime": `must be in the format "<runtime> mins"`}
+			return row
+		}
+
+		row.errors = map[string]string{"row": message}
+		return row
+	}
+
+	row.movie = &data.Movie{
+		Title: input.Title,
+		Year: input.Year,
+		Runtime: input.Runtime,
+		Genres: input.Genres,
+	}
+
+	return row
+}
+
+// csvMovieReader reads CSV with a header line naming the title, year, runtime and
+// genres columns, in any order. Several genres go in one quoted field separated by
+// commas, and the runtime can be written either as "<runtime> mins" or as a number.
+type csvMovieReader struct {
+	r *csv.Reader
+	columns map[string]int
+}
+
+func newCSVMovieReader(r io.Reader) (*csvMovieReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, fmt.Errorf("body contains a badly-formed CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.In(name, "title", "year", "runtime", "genres") {
+			return nil, fmt.Errorf("CSV header contains unknown column %q", name)
+		}
+		columns[name] = i
+	}
+
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header must include a %q column", name)
+		}
+	}
+
+	return &csvMovieReader{r: cr, columns: columns}, nil
+}
+
+func (cr *csvMovieReader) next() (*importRow, error) {
+	record, err := cr.r.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return &importRow{
+				line: parseError.StartLine,
+				errors: map[string]string{"row": parseError.Err.Error()},
+			}, nil
+		}
+		return nil, err
+	}
+
+	line, _ := cr.r.FieldPos(0)
+	row := &importRow{line: line, errors: map[string]string{}}
+
+	movie := &data.Movie{Title: strings.TrimSpace(record[cr.columns["title"]])}
+
+	year, err := strconv.ParseInt(strings.TrimSpace(record[cr.columns["year"]]), 10, 32)
+	if err != nil {
+		row.errors["year"] = "must be an integer value"
+	}
+	movie.Year = int32(year)
+
+	movie.Runtime, err = data.ParseRuntime(record[cr.columns["runtime"]])
+	if err != nil {
+		row.errors["runtime"] = `must be in the format "<runtime> mins" or an integer`
+	}
+
+	for _, genre := range strings.Split(record[cr.columns["genres"]], ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			movie.Genres = append(movie.Genres, genre)
+		}
+	}
+
+	row.movie = movie
+	return row, nil
+}
+
+// The importDeadlines() middleware extends the deadlines before anything reads the
+// body, as idempotent() does when an import carries an Idempotency-Key.
+func (app *application) importDeadlines(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		extendImportDeadlines(w)
+		next(w, r)
+	}
+}
+
+// extendImportDeadlines gives the connection read and write deadlines which are long
+// enough to stream an import in and still send the report at the end. The server's own
+// timeouts would otherwise cut the import off before it is finished.
+func extendImportDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(10 * time.Minute))
+	rc.SetWriteDeadline(time.Now().Add(11 * time.Minute))
+}
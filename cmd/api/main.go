@@ -19,12 +19,35 @@ const version = "1.0.0"
 type config struct {
 	port int
 	env string
+	putUpsert bool
 	db struct {
 		dsn string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime string
 	}
+	movieImport struct {
+		maxBytes int64
+		batchSize int
+	}
+	// limiter configures the per-client rate limit of the endpoints that have one,
+	// such as the title suggestions.
+	limiter struct {
+		rps float64
+		burst int
+		enabled bool
+	}
+	suggestCache struct {
+		ttl time.Duration
+		maxEntries int
+	}
+	idempotency struct {
+		ttl time.Duration
+		lockTimeout time.Duration
+	}
+	genreCache struct {
+		ttl time.Duration
+	}
 }
 
 // struct  to hold the dependencies for our HTTP handlers, helpers, // and middleware.
@@ -32,6 +55,9 @@ type application struct {
 	config config
 	logger *log.Logger
 	models data.Models
+	idempotency idempotencyStore
+	suggestions *suggestionCache
+	vocabulary *vocabularyCache
 }
 
 func main() {
@@ -48,6 +74,23 @@ func main() {
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections") 
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
 
+	flag.BoolVar(&cfg.putUpsert, "put-upsert", false, "Allow PUT /v1/movies/:id to create a movie at an id that doesn't exist yet")
+
+	flag.Int64Var(&cfg.movieImport.maxBytes, "import-max-bytes", 100<<20, "Maximum size of a movie import request body")
+	flag.IntVar(&cfg.movieImport.batchSize, "import-batch-size", 500, "Number of movies inserted per batch during an import")
+
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 10, "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 20, "Rate limiter maximum burst")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	flag.DurationVar(&cfg.suggestCache.ttl, "suggest-cache-ttl", 30*time.Second, "How long title suggestions are cached for")
+	flag.IntVar(&cfg.suggestCache.maxEntries, "suggest-cache-entries", 10000, "Maximum number of prefixes to cache title suggestions for")
+
+	flag.DurationVar(&cfg.genreCache.ttl, "genre-cache-ttl", 5*time.Minute, "How long the genre vocabulary is cached for")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses are kept for replaying to requests with the same Idempotency-Key")
+	flag.DurationVar(&cfg.idempotency.lockTimeout, "idempotency-lock-timeout", 15*time.Minute, "How long a request can hold an Idempotency-Key without storing a response, which must be longer than an import can take")
+
 
 	flag.Parse()
 
@@ -61,10 +104,15 @@ func main() {
 
 	logger.Printf("database connection pool established")
 
+	models := data.NewModels(db)
+
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
+		models: models,
+		idempotency: models.Idempotency,
+		suggestions: newSuggestionCache(cfg.suggestCache.ttl, cfg.suggestCache.maxEntries),
+		vocabulary: newVocabularyCache(cfg.genreCache.ttl),
 	}
 
 	
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+
+	"golang.org/x/time/rate"
+)
+
+// The authenticate() middleware looks up the user for the bearer token in the
+// Authorization header, and adds them to the request context. Requests without the
+// header carry the AnonymousUser instead. A header holding an invalid or expired
+// token is rejected outright.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.models.User.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAuthenticatedUser() middleware rejects requests from anonymous users.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// The requireAdmin() middleware rejects requests from users who aren't admins.
+func (app *application) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.IsAdmin {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// The rateLimit() middleware limits the rate each client IP address can make requests
+// to the handler at, using a token bucket per client. Each use of it has its own set of
+// buckets, so that one endpoint can be limited separately from the others. Clients that
+// haven't been seen for three minutes are forgotten.
+func (app *application) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	type client struct {
+		limiter *rate.Limiter
+		lastSeen time.Time
+	}
+
+	var (
+		mu sync.Mutex
+		clients = make(map[string]*client)
+	)
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			mu.Lock()
+			for ip, client := range clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(clients, ip)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		mu.Lock()
+
+		if _, found := clients[ip]; !found {
+			clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
+		}
+
+		clients[ip].lastSeen = time.Now()
+
+		if !clients[ip].limiter.Allow() {
+			mu.Unlock()
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		mu.Unlock()
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// The idempotent() middleware makes POST requests sent with an Idempotency-Key header
+// safe to retry. The first request with a key is handled as usual and its response is
+// stored; a retry with the same key and the same request gets the stored response
+// again, rather than, say, creating a second movie. Reusing a key for a different
+// request is rejected, as is a retry while the first request is still being handled.
+// Server errors aren't stored, so that the request can be retried with the same key.
+//
+// The request body has to be read in full up front to fingerprint the request, so it
+// is buffered up to maxBytes, which should be the size the handler itself accepts.
+// Streaming bodies, such as imports, are held in memory when they carry a key.
+func (app *application) idempotent(maxBytes int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		v := validator.New()
+
+		if data.ValidateIdempotencyKey(v, key); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+				return
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The fingerprint covers everything that decides what the request does: the
+		// target, the content type and the body.
+		h := sha256.New()
+		fmt.Fprintf(h, "%s %s\n%s\n", r.Method, r.URL.RequestURI(), r.Header.Get("Content-Type"))
+		h.Write(body)
+		fingerprint := h.Sum(nil)
+
+		userID := app.contextGetUser(r).ID
+
+		record, claimed, err := app.idempotency.Claim(key, userID, fingerprint, app.config.idempotency.ttl, app.config.idempotency.lockTimeout)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !claimed {
+			switch {
+			case !bytes.Equal(record.Fingerprint, fingerprint):
+				app.idempotencyKeyReusedResponse(w, r)
+			case record.Status == 0:
+				app.idempotencyKeyInFlightResponse(w, r)
+			default:
+				for name, values := range record.Headers {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.Status)
+				w.Write(record.Body)
+			}
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+
+		// If the handler panics the key is released, so that it doesn't stay claimed
+		// until it expires.
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := app.idempotency.Release(key, userID); err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		next(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		if rec.status >= 500 {
+			return
+		}
+
+		err = app.idempotency.Complete(&data.IdempotencyRecord{
+			Key: key,
+			UserID: userID,
+			Status: rec.status,
+			Headers: rec.Header().Clone(),
+			Body: rec.body.Bytes(),
+		})
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		completed = true
+	}
+}
+
+// idempotencyStore is the part of data.IdempotencyModel that the idempotent()
+// middleware uses, so that the middleware can be tested without a database.
+type idempotencyStore interface {
+	Claim(key string, userID int64, fingerprint []byte, ttl, lockTimeout time.Duration) (*data.IdempotencyRecord, bool, error)
+	Complete(record *data.IdempotencyRecord) error
+	Release(key string, userID int64) error
+}
+
+// idempotencyRecorder passes a response through to the client while keeping a copy of
+// its status code and body for the idempotent() middleware to store.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter, which the
+// import and export handlers use to flush and to change deadlines.
+func (rec *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+// fakeIdempotencyStore keeps idempotency records in memory, standing in for
+// data.IdempotencyModel, which is tested against the database in the data package.
+type fakeIdempotencyStore struct {
+	records map[string]data.IdempotencyRecord
+	err error
+}
+
+func newFakeIdempotencyStore() *fakeIdempotencyStore {
+	return &fakeIdempotencyStore{records: make(map[string]data.IdempotencyRecord)}
+}
+
+func (s *fakeIdempotencyStore) id(key string, userID int64) string {
+	return fmt.Sprintf("%d/%s", userID, key)
+}
+
+func (s *fakeIdempotencyStore) Claim(key string, userID int64, fingerprint []byte, ttl, lockTimeout time.Duration) (*data.IdempotencyRecord, bool, error) {
+	if s.err != nil {
+		return nil, false, s.err
+	}
+
+	if record, ok := s.records[s.id(key, userID)]; ok {
+		return &record, false, nil
+	}
+
+	s.records[s.id(key, userID)] = data.IdempotencyRecord{Key: key, UserID: userID, Fingerprint: fingerprint}
+	return nil, true, nil
+}
+
+func (s *fakeIdempotencyStore) Complete(record *data.IdempotencyRecord) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	stored := s.records[s.id(record.Key, record.UserID)]
+	stored.Status = record.Status
+	stored.Headers = record.Headers
+	stored.Body = record.Body
+	s.records[s.id(record.Key, record.UserID)] = stored
+	return nil
+}
+
+func (s *fakeIdempotencyStore) Release(key string, userID int64) error {
+	delete(s.records, s.id(key, userID))
+	return nil
+}
+
+func newIdempotencyTestApp() (*application, *fakeIdempotencyStore) {
+	store := newFakeIdempotencyStore()
+
+	app := &application{logger: log.New(io.Discard, "", 0), idempotency: store}
+	app.config.idempotency.ttl = time.Hour
+	app.config.idempotency.lockTimeout = time.Minute
+
+	return app, store
+}
+
+// sendIdempotent sends a POST request through the idempotent() middleware, with the
+// given body size limit, as the given user.
+func sendIdempotent(app *application, maxBytes int64, next http.HandlerFunc, user *data.User, target, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	r = app.contextSetUser(r, user)
+
+	w := httptest.NewRecorder()
+	app.idempotent(maxBytes, next)(w, r)
+
+	return w
+}
+
+func TestIdempotentTurnedAway(t *testing.T) {
+	app, store := newIdempotencyTestApp()
+
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	})
+
+	tests := []struct {
+		name string
+		key string
+		body string
+		wantStatus int
+		wantCalls int
+	}{
+		{"no key", "", `{"title":"Heat"}`, http.StatusOK, 1},
+		{"key too long", strings.Repeat("k", 256), `{}`, http.StatusUnprocessableEntity, 0},
+		{"body too large", "abc", strings.Repeat(" ", maxJSONBytes+1), http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+
+			w := sendIdempotent(app, maxJSONBytes, next, data.AnonymousUser, "/v1/movies", tt.key, tt.body)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", w.Code, tt.wantStatus)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls to the handler; want %d", calls, tt.wantCalls)
+			}
+			if tt.wantCalls > 0 && w.Body.String() != tt.body {
+				t.Errorf("the handler was sent the body %q; want %q", w.Body.String(), tt.body)
+			}
+			if len(store.records) != 0 {
+				t.Errorf("got %d keys claimed; want none", len(store.records))
+			}
+		})
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	app, store := newIdempotencyTestApp()
+
+	alice := &data.User{ID: 1}
+	bob := &data.User{ID: 2}
+
+	calls := 0
+	status := http.StatusCreated
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", fmt.Sprintf("/v1/movies/%d", calls))
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d}`, calls)
+	})
+
+	send := func(user *data.User, target, key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return sendIdempotent(app, maxJSONBytes, next, user, target, key, body)
+	}
+
+	w := send(alice, "/v1/movies", "create-heat", `{"title":"Heat"}`)
+	if w.Code != http.StatusCreated || calls != 1 {
+		t.Fatalf("first request: got status %d after %d calls; want 201 after 1", w.Code, calls)
+	}
+
+	// A retry gets the stored response, without the handler running again.
+	w = send(alice, "/v1/movies", "create-heat", `{"title":"Heat"}`)
+	if w.Code != http.StatusCreated || calls != 1 {
+		t.Errorf("retry: got status %d after %d calls; want 201 after 1", w.Code, calls)
+	}
+	if w.Body.String() != `{"call":1}` || w.Header().Get("Location") != "/v1/movies/1" || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: got body %q and headers %v; want the replayed first response", w.Body.String(), w.Header())
+	}
+
+	// Reusing the key for another request is refused.
+	for _, tt := range []struct{ target, body string }{
+		{"/v1/movies", `{"title":"Alien"}`},
+		{"/v1/movies/batch", `{"title":"Heat"}`},
+	} {
+		w = send(alice, tt.target, "create-heat", tt.body)
+		if w.Code != http.StatusUnprocessableEntity || calls != 1 {
+			t.Errorf("reused key for %s %s: got status %d after %d calls; want 422 after 1", tt.target, tt.body, w.Code, calls)
+		}
+	}
+
+	// Keys belong to the user who sent them.
+	w = send(bob, "/v1/movies", "create-heat", `{"title":"Heat"}`)
+	if w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("another user's key: got status %d after %d calls; want 201 after 2", w.Code, calls)
+	}
+
+	// A server error isn't stored, so the request can be retried with the same key.
+	status = http.StatusInternalServerError
+	w = send(alice, "/v1/movies", "create-alien", `{"title":"Alien"}`)
+	if w.Code != http.StatusInternalServerError || calls != 3 {
+		t.Errorf("failed request: got status %d after %d calls; want 500 after 3", w.Code, calls)
+	}
+
+	status = http.StatusCreated
+	w = send(alice, "/v1/movies", "create-alien", `{"title":"Alien"}`)
+	if w.Code != http.StatusCreated || calls != 4 || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after a server error: got status %d after %d calls; want a fresh 201 after 4", w.Code, calls)
+	}
+
+	// A route that accepts larger bodies, such as the import, buffers them up to its
+	// own limit.
+	w = sendIdempotent(app, 4*maxJSONBytes, next, alice, "/v1/movies/import", "import", strings.Repeat(" ", maxJSONBytes+1))
+	if w.Code != http.StatusCreated || calls != 5 {
+		t.Errorf("large import: got status %d after %d calls; want 201 after 5", w.Code, calls)
+	}
+
+	// A request that's still being handled holds the key, so a retry sent meanwhile is
+	// told to try again later.
+	var retry *httptest.ResponseRecorder
+	sendIdempotent(app, maxJSONBytes, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retry = send(alice, "/v1/movies", "in-flight", `{"title":"Heat"}`)
+		w.WriteHeader(http.StatusCreated)
+	}), alice, "/v1/movies", "in-flight", `{"title":"Heat"}`)
+
+	if retry.Code != http.StatusConflict || calls != 5 {
+		t.Errorf("retry while in flight: got status %d after %d calls; want 409 after 5", retry.Code, calls)
+	}
+
+	// A handler that panics releases the key on its way out.
+	func() {
+		defer func() { recover() }()
+
+		sendIdempotent(app, maxJSONBytes, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}), alice, "/v1/movies", "panics", `{}`)
+	}()
+
+	if _, ok := store.records[store.id("panics", alice.ID)]; ok {
+		t.Error("the key is still claimed after a panic")
+	}
+
+	// If the key can't be claimed, the request isn't handled.
+	store.err = errors.New("store unavailable")
+	send(alice, "/v1/movies", "unavailable", `{}`)
+	if calls != 5 {
+		t.Errorf("store unavailable: got %d calls; want 5", calls)
+	}
+}
@@ -1,15 +1,66 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/Marsh-sudo/greenlight/internal/data"
 	"github.com/Marsh-sudo/greenlight/internal/validator"
 )
 
+// movieSortSafelist holds the sort values accepted by the endpoints that list movies.
+// Sorting by relevance puts the titles closest to the title filter first.
+var movieSortSafelist = []string{"id", "title", "year", "runtime", "rating", "relevance", "-id", "-title", "-year", "-runtime", "-rating"}
+
+// trashSortSafelist holds the sort values accepted when listing the trash.
+var trashSortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+// movieFieldSafelist holds the fields a client can narrow the movies it is sent down to
+// with the fields parameter.
+var movieFieldSafelist = []string{"id", "title", "year", "runtime", "genres", "version", "rating"}
+
+// sparseMovie returns just the given fields of the movie, keyed by their names in its
+// JSON representation. The values keep their types, so the runtime is still rendered
+// in the "<runtime> mins" format.
+func sparseMovie(movie *data.Movie, fields []string) map[string]interface{} {
+	values := map[string]interface{}{}
+
+	for _, field := range fields {
+		switch field {
+		case "id":
+			values[field] = movie.ID
+		case "title":
+			values[field] = movie.Title
+		case "year":
+			values[field] = movie.Year
+		case "runtime":
+			values[field] = movie.Runtime
+		case "genres":
+			values[field] = movie.Genres
+		case "version":
+			values[field] = movie.Version
+		case "rating":
+			values[field] = movie.Rating
+		}
+	}
+
+	return values
+}
+
+// sparseMovies applies sparseMovie() to each of the movies.
+func sparseMovies(movies []*data.Movie, fields []string) []map[string]interface{} {
+	sparse := make([]map[string]interface{}, len(movies))
+	for i, movie := range movies {
+		sparse[i] = sparseMovie(movie, fields)
+	}
+
+	return sparse
+}
+
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
@@ -33,6 +84,15 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 	// initialize a new validator instance
 	v := validator.New()
+
+	// The genres are checked against the vocabulary and replaced with their canonical
+	// slugs before the rest of the movie is validated.
+	vocab, err := app.genreVocabulary()
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+		return
+	}
+	data.ValidateMovieGenres(v,vocab,movie)
 	
 	// Call the ValidateMovie() function and return a response containing the errors if // any of the checks fail.
 	if data.ValidateMovie(v,movie); !v.Valid() {
@@ -43,7 +103,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// Call the Insert() method on our movies model, passing in a pointer to the
 	// validated movie struct. This will create a record in the database and update the 
 	// movie struct with the system-generated information.
-	err = app.models.Movie.Insert(movie)
+	err = app.movieModel(r).Insert(movie)
 	if err != nil {
 		app.serverErrorResponse(w,r,err)
 		return
@@ -74,9 +134,28 @@ func(app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// An as_of timestamp asks for the movie as it was at that time, rebuilt from its
+	// revision history.
+	v := validator.New()
+
+	asOf := app.readTime(r.URL.Query(),"as_of",v)
+
+	// The fields value narrows the movie down to the fields the client needs.
+	fields := app.readCSV(r.URL.Query(),"fields",nil)
+
+	if data.ValidateFields(v,fields,movieFieldSafelist); !v.Valid() {
+		app.failedValidationResponse(w,r,v.Errors)
+		return
+	}
+
 	// cll the get() methos to fetch the data for a specific movie and also
 	// use the errors.Is() function to check if it returns a data.ErrRecordNotFound
-	movie,err := app.models.Movie.Get(id)
+	var movie *data.Movie
+	if asOf != nil {
+		movie,err = app.models.Movie.GetAsOf(id,*asOf,fields...)
+	} else {
+		movie,err = app.models.Movie.Get(id,fields...)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err,data.ErrRecordNotFound):
@@ -89,13 +168,15 @@ func(app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 
 
 
-	err = app.writeJSON(w,http.StatusOK,envelope{"movie":movie},nil)
+	env := envelope{"movie":movie}
+	if len(fields) > 0 {
+		env["movie"] = sparseMovie(movie,fields)
+	}
+
+	err = app.render(w,r,http.StatusOK,env,nil)
 	if err != nil {
 		app.serverErrorResponse(w,r,err)
 	}
-
-	fmt.Fprintf(w, "show the details of movie %d\n",id)
-
 }
 
 
@@ -119,65 +200,209 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if r.Header.Get("X-Expected-Version") != "" {
-		if strconv.FormatInt(int64(movie.Version),32) != r.Header.Get("X-Expected-Version") {
+	if !app.expectedVersionMatches(r,movie) {
+		app.editConflictResponse(w,r)
+		return
+	}
+
+	// The Content-Type header decides how the body is read. A plain JSON body holds
+	// the fields to change, while the two patch formats describe changes to the
+	// movie's JSON representation.
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/merge-patch+json", "application/json-patch+json":
+		var patch json.RawMessage
+
+		err = app.readJSON(w,r,&patch)
+		if err != nil {
+			app.badRequestResponse(w,r,err)
+			return
+		}
+
+		err = applyMoviePatch(movie,mediaType,patch)
+		if err != nil {
+			switch {
+			case errors.Is(err,errPatchTestFailed):
+				app.errorResponse(w,r,http.StatusConflict,err.Error())
+			default:
+				app.badRequestResponse(w,r,err)
+			}
+			return
+		}
+
+	case "", "application/json":
+		// declare an input struct to hold the expected data
+		//using pointer for the Title,Year and Runtime
+		var input struct{
+			Title *string `json:"title"`
+			Year *int32 `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres []string `json:"genres"` 
+		}
+
+		//read the JSON request body data into the input struct
+		err = app.readJSON(w,r,&input)
+		if err != nil {
+			app.badRequestResponse(w,r,err)
+			return
+		}
+
+		//copy the values from the request body to the appropriate fields of the movie
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+
+	default:
+		app.unsupportedMediaTypeResponse(w,r,mediaType)
+		return
+	}
+
+	//validate the updated movie record sendiing the client a 422 Unprocessable Entity
+	v := validator.New()
+
+	vocab, err := app.genreVocabulary()
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+		return
+	}
+	data.ValidateMovieGenres(v,vocab,movie)
+
+	if data.ValidateMovie(v,movie); !v.Valid() {
+		app.failedValidationResponse(w,r,v.Errors)
+		return
+	}
+
+	// pass the updated movie record to our new Update method
+	err = app.movieModel(r).Update(movie)
+	if err != nil {
+		switch {
+		case errors.Is(err,data.ErrEditConflict):
 			app.editConflictResponse(w,r)
+		default:
+			app.serverErrorResponse(w, r,err)
+		}
+		return
+	}
+
+	//write the updated movie record in a JSON response
+	err = app.writeJSON(w,http.StatusOK,envelope{"movie":movie},nil)
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+	}
+}
+
+// The replaceMovieHandler() handles PUT requests, which carry a complete new
+// representation of the movie rather than just the fields to change. When the server
+// is started with -put-upsert, a PUT to an id that doesn't exist yet creates the movie
+// at that id, which lets sync jobs mirror ids from another system.
+func (app *application) replaceMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w,r)
+		return
+	}
+
+	creating := false
+
+	movie, err := app.models.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err,data.ErrRecordNotFound) && app.config.putUpsert:
+			creating = true
+			movie = &data.Movie{ID: id}
+		case errors.Is(err,data.ErrRecordNotFound):
+			app.notFoundResponse(w,r)
+			return
+		default:
+			app.serverErrorResponse(w,r,err)
 			return
 		}
 	}
 
-	// declare an input struct to hold the expected data
-	//using pointer for the Title,Year and Runtime
-	var input struct{
+	// A client that sends an expected version is replacing a movie it has already
+	// seen, so if the movie doesn't exist any more that's a conflict too.
+	if (creating && r.Header.Get("X-Expected-Version") != "") || (!creating && !app.expectedVersionMatches(r,movie)) {
+		app.editConflictResponse(w,r)
+		return
+	}
+
+	// The fields are pointers so that a missing field can be told apart from one set
+	// to its zero value. Every field has to be present.
+	var input struct {
 		Title *string `json:"title"`
 		Year *int32 `json:"year"`
 		Runtime *data.Runtime `json:"runtime"`
-		Genres []string `json:"genres"` 
+		Genres []string `json:"genres"`
 	}
 
-	//read the JSON request body data into the input struct
 	err = app.readJSON(w,r,&input)
 	if err != nil {
 		app.badRequestResponse(w,r,err)
 		return
 	}
 
-	//copy the values from the request body to the appropriate fields of the movie
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
+	v := validator.New()
 
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+	v.Check(input.Title != nil, "title", "must be provided")
+	v.Check(input.Year != nil, "year", "must be provided")
+	v.Check(input.Runtime != nil, "runtime", "must be provided")
+	v.Check(input.Genres != nil, "genres", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w,r,v.Errors)
+		return
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	movie.Title = *input.Title
+	movie.Year = *input.Year
+	movie.Runtime = *input.Runtime
+	movie.Genres = input.Genres
+
+	vocab, err := app.genreVocabulary()
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+		return
 	}
+	data.ValidateMovieGenres(v,vocab,movie)
 
-	//validate the updated movie record sendiing the client a 422 Unprocessable Entity
-	v := validator.New()
 	if data.ValidateMovie(v,movie); !v.Valid() {
 		app.failedValidationResponse(w,r,v.Errors)
 		return
 	}
 
-	// pass the updated movie record to our new Update method
-	err = app.models.Movie.Update(movie)
+	status := http.StatusOK
+	headers := make(http.Header)
+
+	if creating {
+		err = app.movieModel(r).InsertWithID(movie)
+		status = http.StatusCreated
+		headers.Set("Location",fmt.Sprintf("/v1/movies/%d",movie.ID))
+	} else {
+		err = app.movieModel(r).Update(movie)
+	}
+
 	if err != nil {
 		switch {
 		case errors.Is(err,data.ErrEditConflict):
 			app.editConflictResponse(w,r)
 		default:
-			app.serverErrorResponse(w, r,err)
+			app.serverErrorResponse(w,r,err)
 		}
 		return
 	}
 
-	//write the updated movie record in a JSON response
-	err = app.writeJSON(w,http.StatusOK,envelope{"movie":movie},nil)
+	err = app.writeJSON(w,status,envelope{"movie":movie},headers)
 	if err != nil {
 		app.serverErrorResponse(w,r,err)
 	}
@@ -191,8 +416,8 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	//delete the movie from the database,sending a 404 Not found response to the client
-	err = app.models.Movie.Delete(id)
+	//move the movie to the trash,sending a 404 Not found response to the client
+	err = app.movieModel(r).Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err,data.ErrRecordNotFound):
@@ -204,7 +429,7 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	//return a 200 OK status code along with a success message
-	err = app.writeJSON(w,http.StatusOK,envelope{"message":"movie successfully deleted"},nil)
+	err = app.writeJSON(w,http.StatusOK,envelope{"message":"movie successfully moved to the trash"},nil)
 	if err != nil {
 		app.serverErrorResponse(w,r,err)
 	}
@@ -214,8 +439,9 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 func (app *application) listMoviesHandler(w http.ResponseWriter,r *http.Request) {
 	// To keep things consistent with our other handlers, we'll define an input struct // to hold the expected values from the request query string
 	var input struct {
-		Title string
-		Genres []string
+		data.MovieFilter
+		AsOf *time.Time
+		Facets []string
 		data.Filters
 	}
 
@@ -224,10 +450,21 @@ func (app *application) listMoviesHandler(w http.ResponseWriter,r *http.Request)
 	// Call r.URL.Query() to get the url.Values map containing the query string data.
 	qs := r.URL.Query()
 
-	// Use our helpers to extract the title and genres query string values, falling back // to defaults of an empty string and an empty slice respectively if they are not
-	// provided by the client.
-	input.Title = app.readString(qs,"title", "")
-	input.Genres = app.readCSV(qs,"genres",[]string{})
+	// An ids value asks for those movies in particular, in the order given, so the
+	// filtering, sorting and paging parameters don't apply.
+	if qs.Has("ids") {
+		ids := app.readIDs(qs,"ids",v)
+		app.batchGetMovies(w,r,ids,app.readCSV(qs,"fields",nil),v)
+		return
+	}
+
+	// An as_of timestamp lists the catalog as it was at that time, with the same
+	// filters and sorting as the live listing.
+	input.AsOf = app.readTime(qs,"as_of",v)
+
+	// Use our helpers to extract the title, genres, year and runtime filters. Each of
+	// them matches every movie if it isn't provided by the client.
+	input.MovieFilter = app.readMovieFilter(qs,v)
 
 	// Get the page and page_size query string values as integers. Notice that we set // the default page value to 1 and default page_size to 20, and that we pass the // validator instance as the final argument here.
 	input.Filters.Page = app.readInt(qs,"page",1,v)
@@ -236,8 +473,30 @@ func (app *application) listMoviesHandler(w http.ResponseWriter,r *http.Request)
 	// Extract the sort query string value, falling back to "id" if it is not provided // by the client (which will imply a ascending sort on movie ID).
 	input.Filters.Sort = app.readString(qs,"sort","id")
 
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = movieSortSafelist
+
+	// The cursor value is the opaque next_cursor returned in the metadata of a previous
+	// response. It can be used instead of the page number to fetch the following page.
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+
+	// The count value says how the matching movies are counted for the metadata. An
+	// estimate or no count at all saves counting every match on a large catalog.
+	input.Filters.Count = app.readString(qs, "count", "exact")
+
+	// The fields value narrows each movie down to the fields the client needs.
+	input.Filters.Fields = app.readCSV(qs, "fields", nil)
+	input.Filters.FieldSafelist = movieFieldSafelist
+
+	// The facets value names the facets to count over all of the matching movies, not
+	// just the ones on this page.
+	input.Facets = app.readCSV(qs,"facets",[]string{})
+
+	for _,facet := range input.Facets {
+		v.Check(validator.In(facet,data.FacetNames...),"facets","must only contain genres, decade or runtime")
+	}
+	v.Check(validator.Unique(input.Facets),"facets","must not contain duplicate values")
 
+	data.ValidateMovieFilter(v,input.MovieFilter,input.Filters)
 
 	// Check the Validator instance for any errors and use the failedValidationResponse() // helper to send the client a response if necessary.
 	if data.ValidateFilters(v,input.Filters); !v.Valid() {
@@ -245,19 +504,118 @@ func (app *application) listMoviesHandler(w http.ResponseWriter,r *http.Request)
 		return
 	}
 
-	movies,err := app.models.Movie.GetAll(input.Title,input.Genres,input.Filters)
+	err := app.canonicalMovieFilter(&input.MovieFilter)
 	if err != nil {
 		app.serverErrorResponse(w,r,err)
 		return
 	}
 
-	err = app.writeJSON(w,http.StatusOK,envelope{"movies":movies},nil)
+	var movies []*data.Movie
+	var metadata data.Metadata
+
+	if input.AsOf != nil {
+		movies,metadata,err = app.models.Movie.GetAllAsOf(input.MovieFilter,input.Filters,*input.AsOf)
+	} else {
+		movies,metadata,err = app.models.Movie.GetAll(input.MovieFilter,input.Filters)
+	}
 	if err != nil {
 		app.serverErrorResponse(w,r,err)
+		return
+	}
+
+	env := envelope{"movies":movies,"metadata":metadata}
+
+	if len(input.Filters.Fields) > 0 {
+		env["movies"] = sparseMovies(movies,input.Filters.Fields)
 	}
 
+	if len(input.Facets) > 0 {
+		var facets map[string][]data.FacetCount
 
-// Dump the contents of the input struct in a HTTP response.
-	fmt.Fprintf(w, "%+v\n",input)
+		if input.AsOf != nil {
+			facets,err = app.models.Movie.FacetsAsOf(input.MovieFilter,input.Facets,*input.AsOf)
+		} else {
+			facets,err = app.models.Movie.Facets(input.MovieFilter,input.Facets)
+		}
+		if err != nil {
+			app.serverErrorResponse(w,r,err)
+			return
+		}
+
+		env["facets"] = facets
+	}
+
+	// When a search by title comes up empty, offer the closest titles instead.
+	if len(movies) == 0 && input.Title != "" && input.AsOf == nil {
+		suggestions,err := app.models.Movie.SuggestTitles(input.Title)
+		if err != nil {
+			app.serverErrorResponse(w,r,err)
+			return
+		}
+
+		env["did_you_mean"] = suggestions
+	}
 
-}
\ No newline at end of file
+	err = app.render(w,r,http.StatusOK,env,app.paginationHeaders(r,input.Filters,metadata))
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+	}
+}
+
+// The listDeletedMoviesHandler() lists the movies in the trash, most recently deleted
+// first unless the client asks for another sort.
+func (app *application) listDeletedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs,"page",1,v)
+	input.Filters.PageSize = app.readInt(qs,"page_size",20,v)
+	input.Filters.Sort = app.readString(qs,"sort","-deleted_at")
+	input.Filters.SortSafelist = trashSortSafelist
+	input.Filters.Cursor = app.readString(qs,"cursor","")
+
+	if data.ValidateFilters(v,input.Filters); !v.Valid() {
+		app.failedValidationResponse(w,r,v.Errors)
+		return
+	}
+
+	movies,metadata,err := app.models.Movie.GetDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+		return
+	}
+
+	err = app.render(w,r,http.StatusOK,envelope{"movies":movies,"metadata":metadata},nil)
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+	}
+}
+
+// The restoreMovieHandler() takes a movie back out of the trash.
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id,err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w,r)
+		return
+	}
+
+	movie,err := app.movieModel(r).Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err,data.ErrRecordNotFound):
+			app.notFoundResponse(w,r)
+		default:
+			app.serverErrorResponse(w,r,err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w,http.StatusOK,envelope{"movie":movie},nil)
+	if err != nil {
+		app.serverErrorResponse(w,r,err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+var errPatchTestFailed = errors.New("a test operation in the patch failed")
+
+// applyMoviePatch applies a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902)
+// document to the movie. The patch works on the movie's JSON representation, the
+// same one clients get back from the API, so the runtime is written "<runtime> mins"
+// and genres can be addressed individually, e.g. "/genres/-" to append one. The id,
+// version and rating can't be changed by a patch.
+func applyMoviePatch(movie *data.Movie, mediaType string, patch []byte) error {
+	doc, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case "application/merge-patch+json":
+		doc, err = jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return fmt.Errorf("body contains an invalid merge patch: %w", err)
+		}
+	case "application/json-patch+json":
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return fmt.Errorf("body contains an invalid JSON patch: %w", err)
+		}
+
+		doc, err = ops.Apply(doc)
+		if err != nil {
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				return errPatchTestFailed
+			}
+			return fmt.Errorf("the patch could not be applied: %w", err)
+		}
+	default:
+		panic("unsupported patch media type: " + mediaType)
+	}
+
+	var patched struct {
+		ID int64 `json:"id"`
+		Title string `json:"title"`
+		Year int32 `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres []string `json:"genres"`
+		Version int32 `json:"version"`
+		Rating data.MovieRating `json:"rating"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&patched)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &unmarshalTypeError):
+			return fmt.Errorf("the patch sets an incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			return errors.New(`the patch sets runtime to a value not in the format "<runtime> mins"`)
+		default:
+			return fmt.Errorf("the patched movie is invalid: %w", err)
+		}
+	}
+
+	if patched.ID != movie.ID || patched.Version != movie.Version || patched.Rating != movie.Rating {
+		return errors.New("the patch must not change the id, version or rating fields")
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// renderer encodes an envelope in one response format. The first of the media types
+// is the one sent in the Content-Type header, any others are accepted aliases.
+// canRender reports whether the envelope can be expressed in the format at all.
+type renderer struct {
+	mediaTypes []string
+	canRender func(env envelope) bool
+	encode func(env envelope) ([]byte, error)
+}
+
+// renderers lists the supported response formats in order of preference, which is
+// used to settle ties between formats the client likes equally.
+var renderers = []renderer{
+	{
+		mediaTypes: []string{"application/json"},
+		canRender: func(env envelope) bool { return true },
+	},
+	{
+		mediaTypes: []string{"application/xml", "text/xml"},
+		canRender: func(env envelope) bool { return true },
+		encode: func(env envelope) ([]byte, error) {
+			body, err := xml.MarshalIndent(env, "", "\t")
+			if err != nil {
+				return nil, err
+			}
+			return append([]byte(xml.Header), append(body, '\n')...), nil
+		},
+	},
+	{
+		mediaTypes: []string{"application/msgpack", "application/x-msgpack"},
+		canRender: func(env envelope) bool { return true },
+		encode: func(env envelope) ([]byte, error) {
+			var buf bytes.Buffer
+
+			// Use the json struct tags, so that the keys (and omitted fields) match the
+			// JSON representation.
+			enc := msgpack.NewEncoder(&buf)
+			enc.SetCustomStructTag("json")
+
+			err := enc.Encode(map[string]interface{}(env))
+			return buf.Bytes(), err
+		},
+	},
+	{
+		mediaTypes: []string{"text/csv"},
+		canRender: func(env envelope) bool { return envelopeMovies(env) != nil },
+		encode: func(env envelope) ([]byte, error) {
+			var buf bytes.Buffer
+
+			enc := &csvMovieEncoder{w: csv.NewWriter(&buf)}
+			if err := enc.begin(); err != nil {
+				return nil, err
+			}
+			for _, movie := range envelopeMovies(env) {
+				if err := enc.encode(movie); err != nil {
+					return nil, err
+				}
+			}
+
+			err := enc.end()
+			return buf.Bytes(), err
+		},
+	},
+}
+
+// The render() helper sends the envelope in the format the client asked for in its
+// Accept header. The JSON format is written by writeJSON() exactly as before. If
+// none of the acceptable formats can be used, a 406 Not Acceptable response is sent
+// instead.
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, env envelope, headers http.Header) error {
+	w.Header().Add("Vary", "Accept")
+
+	rd, ok := negotiate(r.Header.Get("Accept"), env)
+	if !ok {
+		app.notAcceptableResponse(w, r)
+		return nil
+	}
+
+	if rd.encode == nil {
+		return app.writeJSON(w, status, env, headers)
+	}
+
+	body, err := rd.encode(env)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", rd.mediaTypes[0])
+	w.WriteHeader(status)
+	w.Write(body)
+
+	return nil
+}
+
+// negotiate picks the renderer the client prefers, according to the quality values
+// in the Accept header. Each renderer gets the quality of the most specific media
+// range matching it, so "text/csv;q=0" still rules out CSV under "*/*". A missing
+// Accept header means that anything is acceptable.
+func negotiate(accept string, env envelope) (renderer, bool) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q float64
+	}
+
+	var ranges []mediaRange
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+
+	best, bestQ := -1, 0.0
+
+	for i, rd := range renderers {
+		if !rd.canRender(env) {
+			continue
+		}
+
+		q, specificity := 0.0, -1
+
+		for _, mr := range ranges {
+			for _, mediaType := range rd.mediaTypes {
+				s := -1
+
+				switch {
+				case mr.mediaType == mediaType:
+					s = 2
+				case strings.HasSuffix(mr.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mr.mediaType, "*")):
+					s = 1
+				case mr.mediaType == "*/*":
+					s = 0
+				}
+
+				if s > specificity {
+					q, specificity = mr.q, s
+				}
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+
+	if best < 0 {
+		return renderer{}, false
+	}
+
+	return renderers[best], true
+}
+
+// envelopeMovies returns the movies held in the envelope, either as a list or as a
+// single movie, or nil if there aren't any.
+func envelopeMovies(env envelope) []*data.Movie {
+	for _, value := range env {
+		switch v := value.(type) {
+		case []*data.Movie:
+			return v
+		case *data.Movie:
+			return []*data.Movie{v}
+		}
+	}
+
+	return nil
+}
+
+// MarshalXML renders the envelope as a <response> element with one child element per
+// key, in key order. encoding/xml can't handle maps or name the items of a list on its
+// own, so nested maps become one child element per key and lists are wrapped in an
+// element named after the key, with items named after its singular form.
+func (env envelope) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "response"}
+	return encodeXMLValue(enc, start, map[string]interface{}(env))
+}
+
+func encodeXMLValue(enc *xml.Encoder, start xml.StartElement, value interface{}) error {
+	rv := reflect.ValueOf(value)
+
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		for _, key := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: key.String()}}
+			if err := encodeXMLValue(enc, child, rv.MapIndex(key).Interface()); err != nil {
+				return err
+			}
+		}
+
+		return enc.EncodeToken(start.End())
+	}
+
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+
+		item := strings.TrimSuffix(start.Name.Local, "s")
+		if item == start.Name.Local {
+			item = "item"
+		}
+
+		for i := 0; i < rv.Len(); i++ {
+			child := xml.StartElement{Name: xml.Name{Local: item}}
+			if err := encodeXMLValue(enc, child, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+
+		return enc.EncodeToken(start.End())
+	}
+
+	return enc.EncodeElement(value, start)
+}
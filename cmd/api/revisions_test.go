@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+func TestListMovieRevisions(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	ids := insertMovies(t, app,
+		&data.Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime", "drama"}},
+		&data.Movie{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+	)
+
+	if err := app.models.Movie.Delete(ids["Alien"]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id int64
+		wantStatus int
+		wantRevisions int
+	}{
+		{"movie", ids["Heat"], http.StatusOK, 1},
+		{"missing movie", 999, http.StatusNotFound, 0},
+		{"trashed movie", ids["Alien"], http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Revisions []map[string]interface{} `json:"revisions"`
+			}
+
+			target := fmt.Sprintf("/v1/movies/%d/revisions", tt.id)
+			status := sendJSON(t, app, routes.ServeHTTP, http.MethodGet, target, "", &resp)
+
+			if status != tt.wantStatus {
+				t.Errorf("got status %d; want %d", status, tt.wantStatus)
+			}
+			if len(resp.Revisions) != tt.wantRevisions {
+				t.Errorf("got %d revisions; want %d", len(resp.Revisions), tt.wantRevisions)
+			}
+		})
+	}
+}
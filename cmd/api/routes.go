@@ -5,17 +5,80 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-func (app *application) routes() *httprouter.Router {
+func (app *application) routes() http.Handler {
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.listMoviesHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck",app.healthcheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies",app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies",app.idempotent(maxJSONBytes, app.createMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.namedOrID(map[string]http.HandlerFunc{
+		"import": app.importDeadlines(app.idempotent(app.config.movieImport.maxBytes, app.importMoviesHandler)),
+		"batch": app.idempotent(maxJSONBytes, app.batchMoviesHandler),
+		"batch-get": app.idempotent(maxJSONBytes, app.batchGetMoviesHandler),
+	}, app.methodNotAllowedResponse))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.namedOrID(map[string]http.HandlerFunc{
+		"export": app.exportMoviesHandler,
+		"suggest": app.rateLimit(app.suggestMoviesHandler),
+		"trash": app.listDeletedMoviesHandler,
+	}, app.showMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.idempotent(maxJSONBytes, app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert", app.idempotent(maxJSONBytes, app.revertMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.listMovieRevisionsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.showMovieRevisionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/diff", app.diffMovieRevisionsHandler)
 	router.HandlerFunc(http.MethodPatch,"/v1/movies/:id",app.updateMovieHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.replaceMovieHandler)
 	router.HandlerFunc(http.MethodDelete,"/v1/movies/:id",app.deleteMovieHandler)
 
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/rating", app.requireAuthenticatedUser(app.rateMovieHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/rating", app.requireAuthenticatedUser(app.deleteRatingHandler))
 
-	return router
-}
\ No newline at end of file
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.listMovieCreditsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.idempotent(maxJSONBytes, app.createMovieCreditHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.deleteMovieCreditHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.listMovieReviewsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireAuthenticatedUser(app.idempotent(maxJSONBytes, app.createReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews/:review_id", app.showReviewHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.requireAuthenticatedUser(app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.requireAuthenticatedUser(app.deleteReviewHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/reviews", app.requireAdmin(app.listReviewQueueHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/reviews/:id/status", app.requireAdmin(app.moderateReviewHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.listGenresHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.listPeopleHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.idempotent(maxJSONBytes, app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.showPersonHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.updatePersonHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.deletePersonHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id/filmography", app.showFilmographyHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/watchlist", app.requireAuthenticatedUser(app.listWatchlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/watchlist", app.requireAuthenticatedUser(app.idempotent(maxJSONBytes, app.addToWatchlistHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/watchlist", app.requireAuthenticatedUser(app.removeFromWatchlistHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.idempotent(maxJSONBytes, app.registerUserHandler))
+
+
+	return app.authenticate(router)
+}
+
+// httprouter won't register a fixed path segment in the same position as a named
+// parameter, so endpoints like /v1/movies/export share the /v1/movies/:id route.
+// namedOrID() picks out the fixed names and sends everything else to the handler
+// for the :id route.
+func (app *application) namedOrID(named map[string]http.HandlerFunc, byID http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if next, ok := named[params.ByName("id")]; ok {
+			next(w, r)
+			return
+		}
+
+		byID(w, r)
+	}
+}
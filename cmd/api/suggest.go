@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// suggestionCache holds the suggestions for recently typed prefixes, so that popular
+// prefixes, which most searches start with, don't have to go to the database every
+// time. Entries expire after the ttl, which bounds how stale a suggestion can get. When
+// the cache is full the expired entries are swept out, and if that doesn't free any
+// space the new entry isn't cached.
+type suggestionCache struct {
+	mu sync.Mutex
+	ttl time.Duration
+	maxEntries int
+	entries map[string]suggestionCacheEntry
+}
+
+type suggestionCacheEntry struct {
+	suggestions []*data.MovieSuggestion
+	expires time.Time
+}
+
+func newSuggestionCache(ttl time.Duration, maxEntries int) *suggestionCache {
+	return &suggestionCache{
+		ttl: ttl,
+		maxEntries: maxEntries,
+		entries: make(map[string]suggestionCacheEntry),
+	}
+}
+
+func (c *suggestionCache) get(key string) ([]*data.MovieSuggestion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.suggestions, true
+}
+
+func (c *suggestionCache) set(key string, suggestions []*data.MovieSuggestion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+
+	c.entries[key] = suggestionCacheEntry{suggestions: suggestions, expires: now.Add(c.ttl)}
+}
+
+// The suggestMoviesHandler() returns the movies whose title starts with the q query
+// string parameter, for autocompleting a search box.
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(utf8.RuneCountInString(q) <= 100, "q", "must not be more than 100 characters long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key := strconv.Itoa(limit) + ":" + strings.ToLower(q)
+
+	suggestions, ok := app.suggestions.get(key)
+	if !ok {
+		var err error
+
+		suggestions, err = app.models.Movie.Suggest(q, limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.suggestions.set(key, suggestions)
+	}
+
+	err := app.render(w, r, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
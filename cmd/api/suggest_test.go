@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+)
+
+func TestSuggestionCache(t *testing.T) {
+	c := newSuggestionCache(time.Minute, 2)
+
+	heat := []*data.MovieSuggestion{{ID: 1, Title: "Heat"}}
+	her := []*data.MovieSuggestion{{ID: 2, Title: "Her"}}
+
+	if _, ok := c.get("10:he"); ok {
+		t.Fatal("get() from an empty cache: got a hit")
+	}
+
+	c.set("10:hea", heat)
+	c.set("10:her", her)
+
+	if got, ok := c.get("10:hea"); !ok || got[0].Title != "Heat" {
+		t.Errorf("get(10:hea) = %v, %t; want Heat", got, ok)
+	}
+
+	// The cache is full of live entries, so a new one isn't cached.
+	c.set("10:h", heat)
+	if _, ok := c.get("10:h"); ok {
+		t.Error("get(10:h): got a hit for an entry set while the cache was full")
+	}
+
+	// An expired entry is a miss, and is swept out to make space.
+	entry := c.entries["10:her"]
+	entry.expires = time.Now().Add(-time.Second)
+	c.entries["10:her"] = entry
+
+	if _, ok := c.get("10:her"); ok {
+		t.Error("get(10:her): got a hit for an expired entry")
+	}
+
+	c.set("10:h", heat)
+	if _, ok := c.get("10:h"); !ok {
+		t.Error("get(10:h): got a miss after an expired entry was swept out")
+	}
+	if _, ok := c.entries["10:her"]; ok {
+		t.Error("the expired entry was not swept out")
+	}
+}
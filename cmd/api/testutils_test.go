@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/data"
+	"github.com/Marsh-sudo/greenlight/internal/testdb"
+)
+
+// newTestApplication returns an application whose models use the database from
+// testdb.Open(), which skips the test when there isn't one.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	return &application{
+		logger: log.New(io.Discard, "", 0),
+		models: data.NewModels(testdb.Open(t)),
+		vocabulary: newVocabularyCache(time.Minute),
+	}
+}
+
+// insertMovies inserts the movies, returning their ids by title.
+func insertMovies(t *testing.T, app *application, movies ...*data.Movie) map[string]int64 {
+	t.Helper()
+
+	ids := make(map[string]int64)
+	for _, movie := range movies {
+		if err := app.models.Movie.Insert(movie); err != nil {
+			t.Fatal(err)
+		}
+		ids[movie.Title] = movie.ID
+	}
+
+	return ids
+}
+
+// sendJSON sends a request with the body to the handler, as the anonymous user,
+// decodes the JSON response into dst and returns its status code.
+func sendJSON(t *testing.T, app *application, handler http.HandlerFunc, method, target, body string, dst interface{}) int {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r = app.contextSetUser(r, data.AnonymousUser)
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if err := json.NewDecoder(w.Body).Decode(dst); err != nil {
+		t.Fatalf("%s %s: decoding the response: %v", method, target, err)
+	}
+
+	return w.Code
+}
@@ -4,4 +4,14 @@ go 1.20
 
 require github.com/julienschmidt/httprouter v1.3.0
 
-require github.com/lib/pq v1.10.2 
+require (
+	github.com/evanphx/json-patch/v5 v5.6.0
+	github.com/lib/pq v1.10.2
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/time v0.3.0
+)
+
+require (
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+)
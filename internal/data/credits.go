@@ -0,0 +1,197 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+var ErrDuplicateCredit = errors.New("duplicate credit")
+
+// CreditRoles lists the jobs a person can be credited with on a movie.
+var CreditRoles = []string{"director", "writer", "actor"}
+
+// A Credit records a person's work on a movie. Actors are credited with the character
+// they played, and the billing order puts a movie's credits in the order they appear
+// in, lowest first. Depending on the listing, a credit comes with the person or with
+// the movie it is for.
+type Credit struct {
+	ID int64 `json:"id" xml:"id"`
+	MovieID int64 `json:"movie_id" xml:"movie_id"`
+	PersonID int64 `json:"person_id" xml:"person_id"`
+	Role string `json:"role" xml:"role"`
+	Character string `json:"character,omitempty" xml:"character,omitempty"`
+	BillingOrder int32 `json:"billing_order" xml:"billing_order"`
+	Person *Person `json:"person,omitempty" xml:"person,omitempty"`
+	Movie *Movie `json:"movie,omitempty" xml:"movie,omitempty"`
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID != 0, "person_id", "must be provided")
+	v.Check(credit.PersonID > 0, "person_id", "must be a positive integer")
+
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(validator.In(credit.Role, CreditRoles...), "role", "must be one of director, writer or actor")
+
+	v.Check(credit.Role == "actor" || credit.Character == "", "character", "must only be provided for actors")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+// Insert adds the credit. If the person already has the same credit on the movie,
+// ErrDuplicateCredit is returned.
+func (m CreditModel) Insert(credit *Credit) error {
+	query := `
+		INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	err := m.DB.QueryRow(query, args...).Scan(&credit.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_unique_idx"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetForMovie returns all of the movie's credits with the people they are for, in
+// billing order within each role.
+func (m CreditModel) GetForMovie(movieID int64) ([]*Credit, error) {
+	query := `
+		SELECT movie_credits.id, movie_credits.movie_id, movie_credits.person_id, movie_credits.role,
+			movie_credits.character, movie_credits.billing_order,
+			people.id, people.created_at, people.name, COALESCE(people.birth_year, 0), people.version
+		FROM movie_credits
+		INNER JOIN people ON people.id = movie_credits.person_id
+		WHERE movie_credits.movie_id = $1
+		ORDER BY array_position(ARRAY['director', 'writer', 'actor'], movie_credits.role),
+			movie_credits.billing_order, movie_credits.id`
+
+	rows, err := m.DB.Query(query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		credit := Credit{Person: &Person{}}
+
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&credit.Person.ID,
+			&credit.Person.CreatedAt,
+			&credit.Person.Name,
+			&credit.Person.BirthYear,
+			&credit.Person.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// GetForPerson returns a page of the person's filmography: their credits with the
+// movies they are for, sorted by the movies' year or title. Movies in the trash are
+// left out.
+func (m CreditModel) GetForPerson(personID int64, filters Filters) ([]*Credit, Metadata, error) {
+	// As in WatchlistModel.GetAll(), the subquery is named movies so that the column
+	// list and sort column apply to it unchanged.
+	query := fmt.Sprintf(`
+		SELECT %s, credit_id, person_id, role, character, billing_order, count(*) OVER()
+		FROM (
+			SELECT movies.*, movie_credits.id AS credit_id, movie_credits.person_id, movie_credits.role,
+				movie_credits.character, movie_credits.billing_order
+			FROM movies
+			INNER JOIN movie_credits ON movie_credits.movie_id = movies.id
+			WHERE movie_credits.person_id = $1 AND movies.deleted_at IS NULL
+		) AS movies
+		ORDER BY %s, credit_id ASC
+		LIMIT $2 OFFSET $3`, movieColumns, filters.orderBy(nil, "id"))
+
+	rows, err := m.DB.Query(query, personID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	credits := []*Credit{}
+
+	for rows.Next() {
+		credit := Credit{Movie: &Movie{}}
+
+		err := scanMovie(rows, credit.Movie,
+			&credit.ID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&totalRecords,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		credit.MovieID = credit.Movie.ID
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return credits, calculateMetadata(filters, totalRecords), nil
+}
+
+// Delete removes the credit from the movie, or returns ErrRecordNotFound if the movie
+// has no such credit.
+func (m CreditModel) Delete(movieID, creditID int64) error {
+	query := `
+		DELETE FROM movie_credits
+		WHERE id = $1 AND movie_id = $2`
+
+	result, err := m.DB.Exec(query, creditID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
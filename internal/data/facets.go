@@ -0,0 +1,115 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FacetNames lists the facets that can be counted for a movie listing.
+var FacetNames = []string{"genres", "decade", "runtime"}
+
+// A FacetCount is the number of movies in a listing that have a value of a facet: a
+// genre slug, a decade such as "1990", or a runtime bucket such as "90-119" (minutes).
+type FacetCount struct {
+	Value string `json:"value" xml:"value"`
+	Count int `json:"count" xml:"count"`
+}
+
+// facetQueries holds the query that counts each facet over the matches common table
+// expression. Each returns the facet name, the value, its count and the position to
+// list it in. Genres are listed most common first, decades and runtime buckets in
+// order.
+var facetQueries = map[string]string{
+	"genres": `
+		SELECT 'genres', genre, count(*), -count(*)
+		FROM matches, unnest(matches.genres) AS genre
+		GROUP BY genre`,
+	"decade": `
+		SELECT 'decade', (year / 10 * 10)::text, count(*), year / 10 * 10
+		FROM matches
+		GROUP BY year / 10 * 10`,
+	"runtime": `
+		SELECT 'runtime', bucket, count(*), min(runtime)
+		FROM (
+			SELECT runtime, CASE
+				WHEN runtime < 90 THEN '0-89'
+				WHEN runtime < 120 THEN '90-119'
+				WHEN runtime < 150 THEN '120-149'
+				ELSE '150+'
+			END AS bucket
+			FROM matches
+		) AS buckets
+		GROUP BY bucket`,
+}
+
+// Facets counts the values of the named facets over the movies matching the filter,
+// the same ones GetAll() would list. All of the facets are counted
+// in a single query. Every named facet has an entry in the result, even if no movies
+// match.
+func (m MovieModel) Facets(filter MovieFilter, facets []string) (map[string][]FacetCount, error) {
+	where, args := filter.where()
+	return m.facets("WITH", where, args, facets)
+}
+
+// FacetsAsOf is like Facets(), but counts the movies as they were at the given time.
+func (m MovieModel) FacetsAsOf(filter MovieFilter, facets []string, asOf time.Time) (map[string][]FacetCount, error) {
+	where, args := filter.where()
+	with := moviesAsOf(fmt.Sprintf("created_at <= $%d", len(args)+1)) + ","
+	return m.facets(with, where, append(args, asOf), facets)
+}
+
+// facets runs the counting query over the movies matching the where conditions. The
+// with argument starts the WITH clause the matches expression goes in, either the bare
+// keyword or another expression followed by a comma.
+func (m MovieModel) facets(with string, where string, args []interface{}, facets []string) (map[string][]FacetCount, error) {
+	counts := map[string][]FacetCount{}
+
+	if len(facets) == 0 {
+		return counts, nil
+	}
+
+	parts := make([]string, len(facets))
+	for i, facet := range facets {
+		query, ok := facetQueries[facet]
+		if !ok {
+			panic("unknown facet: " + facet)
+		}
+
+		parts[i] = query
+		counts[facet] = []FacetCount{}
+	}
+
+	query := fmt.Sprintf(`%s matches AS (
+			SELECT genres, year, runtime
+			FROM movies
+			WHERE %s
+		)
+		SELECT facet, value, count
+		FROM (%s) AS facets (facet, value, count, position)
+		ORDER BY facet, position, value`, with, where, strings.Join(parts, "\n\t\tUNION ALL"))
+
+	rows, err := m.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var facet string
+		var fc FacetCount
+
+		err := rows.Scan(&facet, &fc.Value, &fc.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[facet] = append(counts[facet], fc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -1,18 +1,233 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
 	"github.com/Marsh-sudo/greenlight/internal/validator"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CountModes are the ways a listing can count the records matching it: exactly,
+// from the query planner's estimate, which is much cheaper on large tables, or not at
+// all.
+var CountModes = []string{"exact", "estimated", "none"}
+
 type Filters struct {
 	Page int
 	PageSize int
 	Sort string
 	SortSafelist []string
+	Cursor string
+	Count string
+	Fields []string
+	FieldSafelist []string
+}
+
+// cursor is the decoded form of the opaque cursor/next_cursor values. It records
+// the sort it was issued for, the sort keys of the last row the client saw, one value
+// per key, and that row's id, which is used to break ties between rows with the same
+// sort keys.
+type cursor struct {
+	Sort string `json:"s"`
+	Values []string `json:"v"`
+	ID int64 `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// A sortKey is one of the comma-separated keys of the Sort field: a column name and
+// whether it is sorted in descending order.
+type sortKey struct {
+	column string
+	desc bool
+}
+
+// parseSort splits a sort value into its keys.
+func parseSort(sort string) []sortKey {
+	var keys []sortKey
+
+	for _, key := range strings.Split(sort, ",") {
+		keys = append(keys, sortKey{
+			column: strings.TrimPrefix(key, "-"),
+			desc: strings.HasPrefix(key, "-"),
+		})
+	}
+
+	return keys
+}
+
+// sortKeys returns the keys of the Sort field. Each key must be one of the entries in
+// our safelist, so it's safe to use its column name in a query.
+func (f Filters) sortKeys() []sortKey {
+	for _, key := range strings.Split(f.Sort, ",") {
+		if !validator.In(key, f.SortSafelist...) {
+			panic("unsafe sort parameter: " + f.Sort)
+		}
+	}
+
+	return parseSort(f.Sort)
+}
+
+// sortsBy reports whether one of the sort keys is the given column.
+func (f Filters) sortsBy(column string) bool {
+	for _, key := range parseSort(f.Sort) {
+		if key.column == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orderBy returns the list of expressions for an ORDER BY clause that sorts by the
+// sort keys in turn, and then by the tiebreaker column, which must be unique, so that
+// rows always come out in the same order and pages don't overlap. The expr function
+// gives the expression to sort by for a column; nil means the column itself.
+func (f Filters) orderBy(expr func(column string) string, tiebreaker string) string {
+	if expr == nil {
+		expr = func(column string) string { return column }
+	}
+
+	var terms []string
+
+	for _, key := range f.sortKeys() {
+		direction := "ASC"
+		if key.desc {
+			direction = "DESC"
+		}
+
+		terms = append(terms, expr(key.column)+" "+direction)
+	}
+
+	if !f.sortsBy(tiebreaker) {
+		terms = append(terms, tiebreaker+" ASC")
+	}
+
+	return strings.Join(terms, ", ")
+}
+
+// keyset returns the condition selecting the rows that come after the cursor in the
+// order given by orderBy(), with an id tiebreaker. A row comes after it if its first
+// sort key is further along in the sort direction, or it is equal to the cursor on the
+// first key and further along on the second, and so on, with the id last. The cursor's
+// values are added to args and referred to by their placeholders.
+func (f Filters) keyset(c cursor, args *[]interface{}) string {
+	keys := f.sortKeys()
+	if !f.sortsBy("id") {
+		keys = append(keys, sortKey{column: "id"})
+	}
+
+	values := append(append([]string{}, c.Values...), strconv.FormatInt(c.ID, 10))
+
+	var alternatives []string
+
+	for i, key := range keys {
+		var conditions []string
+
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, fmt.Sprintf("%s = %s", keys[j].column, placeholder(args, values[j])))
+		}
+
+		op := ">"
+		if key.desc {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s %s", key.column, op, placeholder(args, values[i])))
+
+		alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
 }
 
+// counts reports whether the total number of records should be counted exactly. Listings
+// that don't take a count mode always are, unless they are paged with a cursor, where
+// the total isn't reported.
+func (f Filters) counts() bool {
+	return f.Cursor == "" && (f.Count == "" || f.Count == "exact")
+}
+
+// When paging with a cursor the position comes from the keyset condition, so the
+// offset is always zero.
+func (f Filters) offset() int {
+	if f.Cursor != "" {
+		return 0
+	}
 
+	return (f.Page - 1) * f.PageSize
+}
 
+// Metadata holds the pagination details returned alongside a listing.
+type Metadata struct {
+	CurrentPage int `json:"current_page,omitempty" xml:"current_page,omitempty"`
+	PageSize int `json:"page_size,omitempty" xml:"page_size,omitempty"`
+	FirstPage int `json:"first_page,omitempty" xml:"first_page,omitempty"`
+	LastPage int `json:"last_page,omitempty" xml:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty" xml:"total_records,omitempty"`
+	// Estimated is set when TotalRecords and LastPage come from the query planner's
+	// estimate rather than an exact count.
+	Estimated bool `json:"estimated,omitempty" xml:"estimated,omitempty"`
+	PrevPage int `json:"prev_page,omitempty" xml:"prev_page,omitempty"`
+	NextPage int `json:"next_page,omitempty" xml:"next_page,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+}
+
+// The calculateMetadata() function calculates the appropriate pagination metadata
+// values given the total number of records, current page, and page size values. When
+// the listing was requested with a cursor the page numbers (and the window count, which
+// only covers the rows after the cursor) don't mean anything, so only the page size is
+// reported.
+func calculateMetadata(f Filters, totalRecords int) Metadata {
+	if f.Cursor != "" {
+		return Metadata{PageSize: f.PageSize}
+	}
+
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage: f.Page,
+		PageSize: f.PageSize,
+		FirstPage: 1,
+		LastPage: int(math.Ceil(float64(totalRecords) / float64(f.PageSize))),
+		TotalRecords: totalRecords,
+	}
+}
 
 func ValidateFilters(v *validator.Validator,f Filters) {
 	// chaeck that the page and page_size parameters contain sensible values
@@ -21,5 +236,49 @@ func ValidateFilters(v *validator.Validator,f Filters) {
 	v.Check(f.PageSize > 0,"page_size","must be greater than zero")
 	v.Check(f.PageSize <= 100,"page_size","must be a maximum of 100")
 
-	v.Check(validator.In(f.Sort,f.SortSafelist...),"sort","invalid sort value")
-}
\ No newline at end of file
+	ValidateSort(v,f)
+
+	v.Check(f.Count == "" || validator.In(f.Count, CountModes...), "count", "must be one of exact, estimated or none")
+
+	ValidateFields(v, f.Fields, f.FieldSafelist)
+
+	// A cursor carries its own position, so it can't be combined with a page number,
+	// and it is only meaningful for the sort it was issued for.
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "must be a cursor returned by a previous request")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "was issued for a different sort value")
+		v.Check(err != nil || len(c.Values) == len(strings.Split(f.Sort, ",")), "cursor", "must be a cursor returned by a previous request")
+		v.Check(f.Page == 1, "page", "must not be provided together with a cursor")
+	}
+}
+
+// ValidateFields checks the fields a client asked for against the safelist of fields
+// of the resource that may be selected.
+func ValidateFields(v *validator.Validator, fields []string, safelist []string) {
+	for _, field := range fields {
+		if !validator.In(field, safelist...) {
+			v.AddError("fields", fmt.Sprintf("invalid field %q", field))
+		}
+	}
+
+	v.Check(validator.Unique(fields), "fields", "must not contain duplicate values")
+}
+
+// ValidateSort checks the Sort field, which is a comma-separated list of keys. Each
+// key must be in the safelist, and a column can't be sorted by more than once, in the
+// same direction or the opposite one.
+func ValidateSort(v *validator.Validator, f Filters) {
+	columns := map[string]bool{}
+
+	for _, key := range strings.Split(f.Sort, ",") {
+		if !validator.In(key, f.SortSafelist...) {
+			v.AddError("sort", fmt.Sprintf("invalid sort value %q", key))
+			continue
+		}
+
+		column := strings.TrimPrefix(key, "-")
+		v.Check(!columns[column], "sort", fmt.Sprintf("must not sort by %s more than once", column))
+		columns[column] = true
+	}
+}
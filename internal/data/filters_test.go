@@ -0,0 +1,139 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+func TestFiltersOrderBy(t *testing.T) {
+	relevance := func(column string) string {
+		if column == "relevance" {
+			return "score"
+		}
+		return column
+	}
+
+	tests := []struct {
+		sort string
+		expr func(string) string
+		want string
+	}{
+		{"id", nil, "id ASC"},
+		{"-id", nil, "id DESC"},
+		{"title", nil, "title ASC, id ASC"},
+		{"-year,title", nil, "year DESC, title ASC, id ASC"},
+		{"year,-id", nil, "year ASC, id DESC"},
+		{"relevance,-year", relevance, "score ASC, year DESC, id ASC"},
+	}
+
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafelist: testSortSafelist}
+
+		if got := f.orderBy(tt.expr, "id"); got != tt.want {
+			t.Errorf("orderBy(%q) = %q; want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestFiltersOrderByUnsafe(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("orderBy() with a sort missing from the safelist did not panic")
+		}
+	}()
+
+	f := Filters{Sort: "title,id; DROP TABLE movies", SortSafelist: testSortSafelist}
+	f.orderBy(nil, "id")
+}
+
+func TestFiltersKeyset(t *testing.T) {
+	tests := []struct {
+		sort string
+		values []string
+		want string
+		wantArgs []interface{}
+	}{
+		{
+			"id", nil,
+			"((id > $2))",
+			[]interface{}{"x", "42"},
+		},
+		{
+			"-id", nil,
+			"((id < $2))",
+			[]interface{}{"x", "42"},
+		},
+		{
+			"title", []string{"Heat"},
+			"((title > $2) OR (title = $3 AND id > $4))",
+			[]interface{}{"x", "Heat", "Heat", "42"},
+		},
+		{
+			"-year,title", []string{"1995", "Heat"},
+			"((year < $2) OR (year = $3 AND title > $4) OR (year = $5 AND title = $6 AND id > $7))",
+			[]interface{}{"x", "1995", "1995", "Heat", "1995", "Heat", "42"},
+		},
+		{
+			"year,-id", []string{"1995"},
+			"((year > $2) OR (year = $3 AND id < $4))",
+			[]interface{}{"x", "1995", "1995", "42"},
+		},
+	}
+
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafelist: testSortSafelist}
+
+		// The keyset condition follows the query's own parameters.
+		args := []interface{}{"x"}
+		got := f.keyset(cursor{Sort: tt.sort, Values: tt.values, ID: 42}, &args)
+
+		if got != tt.want {
+			t.Errorf("keyset(%q) = %q; want %q", tt.sort, got, tt.want)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("keyset(%q) args = %v; want %v", tt.sort, args, tt.wantArgs)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := cursor{Sort: "-year,title", Values: []string{"1995", "Heat"}, ID: 42}
+
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("got %+v; want %+v", got, c)
+	}
+
+	if _, err := decodeCursor("not a cursor"); err == nil {
+		t.Error("decodeCursor() of garbage: expected an error")
+	}
+}
+
+func TestValidateSort(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"id", ""},
+		{"-year,title", ""},
+		{"relevance,-rating,id", ""},
+		{"name", `invalid sort value "name"`},
+		{"title,", `invalid sort value ""`},
+		{"title,-title", "must not sort by title more than once"},
+		{"year,year", "must not sort by year more than once"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateSort(v, Filters{Sort: tt.sort, SortSafelist: testSortSafelist})
+
+		if got := v.Errors["sort"]; got != tt.want {
+			t.Errorf("ValidateSort(%q) error = %q; want %q", tt.sort, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// A Genre is one entry of the curated genre vocabulary. Movies store their genres as
+// slugs; the name is the one to show people. Aliases are the other names a genre is
+// known by, which are turned into the slug when a movie is saved.
+type Genre struct {
+	Slug string `json:"slug" xml:"slug"`
+	Name string `json:"name" xml:"name"`
+	Aliases []string `json:"aliases" xml:"aliases>alias"`
+	MovieCount int `json:"movie_count" xml:"movie_count"`
+}
+
+// GenreKey reduces a genre name to the form it is looked up by, so that "Sci-Fi",
+// "sci fi" and "SCI_FI" all become "sci-fi". It must match the genre_key() function
+// in the database.
+func GenreKey(name string) string {
+	var b strings.Builder
+
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+
+	return b.String()
+}
+
+// A GenreVocabulary maps the key of every genre slug and alias to its genre's slug.
+type GenreVocabulary map[string]string
+
+// ValidateMovieGenres replaces the movie's genres with their canonical slugs, dropping
+// any that turn out to name the same genre twice. Genres that aren't in the vocabulary
+// are reported as a validation error, with suggestions of what might have been meant.
+// It is called before ValidateMovie(), which then checks the normalized genres.
+func ValidateMovieGenres(v *validator.Validator, vocab GenreVocabulary, movie *Movie) {
+	if movie.Genres == nil {
+		return
+	}
+
+	genres := []string{}
+	var unknown []string
+
+	for _, genre := range movie.Genres {
+		slug, ok := vocab[GenreKey(genre)]
+		if !ok {
+			unknown = append(unknown, genre)
+			continue
+		}
+
+		if !validator.In(slug, genres...) {
+			genres = append(genres, slug)
+		}
+	}
+
+	if len(unknown) > 0 {
+		message := fmt.Sprintf("contains unknown genre %q", unknown[0])
+		if suggestions := vocab.Suggest(unknown[0]); len(suggestions) > 0 {
+			message += fmt.Sprintf(" (did you mean %s?)", strings.Join(quote(suggestions), " or "))
+		}
+		v.AddError("genres", message)
+		return
+	}
+
+	movie.Genres = genres
+}
+
+// Canonical turns the genres into their slugs for filtering a listing. Genres that
+// aren't in the vocabulary are left as their key, which won't match any movie.
+func (vocab GenreVocabulary) Canonical(genres []string) []string {
+	canonical := make([]string, len(genres))
+
+	for i, genre := range genres {
+		key := GenreKey(genre)
+		if slug, ok := vocab[key]; ok {
+			canonical[i] = slug
+		} else {
+			canonical[i] = key
+		}
+	}
+
+	return canonical
+}
+
+// Suggest returns up to three genre slugs close to the given name, closest first. A
+// slug or alias is close if it is within a couple of typos of the name, or starts
+// with it.
+func (vocab GenreVocabulary) Suggest(name string) []string {
+	key := GenreKey(name)
+	if key == "" {
+		return nil
+	}
+
+	maxDistance := 2
+	if len(key) <= 4 {
+		maxDistance = 1
+	}
+
+	best := map[string]int{}
+
+	for alias, slug := range vocab {
+		distance := levenshtein(key, alias)
+		if len(key) >= 3 && strings.HasPrefix(alias, key) {
+			distance = 1
+		}
+
+		if distance > maxDistance {
+			continue
+		}
+
+		if d, ok := best[slug]; !ok || distance < d {
+			best[slug] = distance
+		}
+	}
+
+	suggestions := make([]string, 0, len(best))
+	for slug := range best {
+		suggestions = append(suggestions, slug)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if best[suggestions[i]] != best[suggestions[j]] {
+			return best[suggestions[i]] < best[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+
+	return suggestions
+}
+
+// levenshtein returns the number of single character insertions, deletions and
+// substitutions it takes to turn a into b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, value := range values[1:] {
+		if value < m {
+			m = value
+		}
+	}
+	return m
+}
+
+func quote(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return quoted
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// Vocabulary loads the genre vocabulary.
+func (m GenreModel) Vocabulary() (GenreVocabulary, error) {
+	rows, err := m.DB.Query(`SELECT alias, slug FROM genre_aliases`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vocab := GenreVocabulary{}
+
+	for rows.Next() {
+		var alias, slug string
+
+		err := rows.Scan(&alias, &slug)
+		if err != nil {
+			return nil, err
+		}
+
+		vocab[alias] = slug
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vocab, nil
+}
+
+// GetAll returns every genre in the vocabulary with its aliases and the number of
+// movies (not counting those in the trash) that have it.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+		SELECT genres.slug, genres.name,
+			ARRAY(SELECT alias FROM genre_aliases WHERE genre_aliases.slug = genres.slug AND alias <> genres.slug ORDER BY alias),
+			COALESCE(counts.movie_count, 0)
+		FROM genres
+		LEFT JOIN (
+			SELECT genre, count(*) AS movie_count
+			FROM movies, unnest(movies.genres) AS genre
+			WHERE deleted_at IS NULL
+			GROUP BY genre
+		) AS counts ON counts.genre = genres.slug
+		ORDER BY genres.slug`
+
+	rows, err := m.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err := rows.Scan(&genre.Slug, &genre.Name, pq.Array(&genre.Aliases), &genre.MovieCount)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
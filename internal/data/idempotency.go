@@ -0,0 +1,128 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// An IdempotencyRecord is what's stored against an idempotency key: a fingerprint of
+// the request that first used it and, once that request has been handled, the response
+// it was given. Status is 0 while the request is still being handled.
+type IdempotencyRecord struct {
+	Key string
+	UserID int64
+	Fingerprint []byte
+	Status int
+	Headers map[string][]string
+	Body []byte
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// ValidateIdempotencyKey checks the key sent in a request's Idempotency-Key header.
+func ValidateIdempotencyKey(v *validator.Validator, key string) {
+	v.Check(len(key) <= 255, "Idempotency-Key", "must not be more than 255 bytes long")
+}
+
+// Claim claims the key for a request with the given fingerprint, until the ttl runs
+// out. It reports whether the key was claimed. If it wasn't, because another request
+// already holds it, that request's record is returned. A key whose ttl has run out is
+// claimed as if it had never been used, and so is a key that has been held for longer
+// than the lock timeout without a response being stored, as the request that claimed
+// it can't still be running; most likely the process handling it died.
+func (m IdempotencyModel) Claim(key string, userID int64, fingerprint []byte, ttl, lockTimeout time.Duration) (*IdempotencyRecord, bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (key, user_id, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key, user_id) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < NOW()
+			OR (idempotency_keys.status IS NULL AND idempotency_keys.created_at < $5)
+		RETURNING key`
+
+	now := time.Now()
+
+	err := m.DB.QueryRow(query, key, userID, fingerprint, now.Add(ttl), now.Add(-lockTimeout)).Scan(&key)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	query = `
+		SELECT key, user_id, fingerprint, COALESCE(status, 0), headers, body
+		FROM idempotency_keys
+		WHERE key = $1 AND user_id = $2`
+
+	var record IdempotencyRecord
+	var headers []byte
+
+	err = m.DB.QueryRow(query, key, userID).Scan(
+		&record.Key,
+		&record.UserID,
+		&record.Fingerprint,
+		&record.Status,
+		&headers,
+		&record.Body,
+	)
+	if err != nil {
+		switch {
+		// The other request released the key in the meantime, so try again.
+		case errors.Is(err, sql.ErrNoRows):
+			return m.Claim(key, userID, fingerprint, ttl, lockTimeout)
+		default:
+			return nil, false, err
+		}
+	}
+
+	if headers != nil {
+		err = json.Unmarshal(headers, &record.Headers)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return &record, false, nil
+}
+
+// Complete stores the response to the request that claimed the key, to be replayed
+// to any retries.
+func (m IdempotencyModel) Complete(record *IdempotencyRecord) error {
+	headers, err := json.Marshal(record.Headers)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $1, headers = $2, body = $3
+		WHERE key = $4 AND user_id = $5`
+
+	_, err = m.DB.Exec(query, record.Status, headers, record.Body, record.Key, record.UserID)
+	return err
+}
+
+// Release gives up the claim on the key without storing a response, so that the
+// request can be retried with it.
+func (m IdempotencyModel) Release(key string, userID int64) error {
+	_, err := m.DB.Exec(`DELETE FROM idempotency_keys WHERE key = $1 AND user_id = $2`, key, userID)
+	return err
+}
+
+// DeleteExpired deletes the keys whose ttl has run out, returning how many there were.
+func (m IdempotencyModel) DeleteExpired() (int64, error) {
+	result, err := m.DB.Exec(`DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/testdb"
+)
+
+func TestIdempotencyClaim(t *testing.T) {
+	db := testdb.Open(t)
+	m := IdempotencyModel{DB: db}
+
+	fingerprint := []byte("fingerprint")
+
+	claim := func(userID int64) (*IdempotencyRecord, bool) {
+		t.Helper()
+
+		record, claimed, err := m.Claim("key", userID, fingerprint, time.Hour, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record, claimed
+	}
+
+	if _, claimed := claim(1); !claimed {
+		t.Fatal("first claim: key not claimed")
+	}
+
+	record, claimed := claim(1)
+	if claimed || record.Status != 0 || string(record.Fingerprint) != "fingerprint" {
+		t.Fatalf("claim while in flight: got claimed %t, record %+v; want the in-flight record", claimed, record)
+	}
+
+	// The request that claimed the key died without storing a response.
+	_, err := db.Exec(`UPDATE idempotency_keys SET created_at = NOW() - INTERVAL '1 hour'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, claimed := claim(1); !claimed {
+		t.Fatal("claim after the lock timeout: key not claimed")
+	}
+
+	// A released key can be claimed again.
+	if err := m.Release("key", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, claimed := claim(1); !claimed {
+		t.Fatal("claim after a release: key not claimed")
+	}
+
+	err = m.Complete(&IdempotencyRecord{Key: "key", UserID: 1, Status: 201, Headers: map[string][]string{"Location": {"/v1/movies/1"}}, Body: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A stored response is kept until the ttl runs out, however old it is.
+	_, err = db.Exec(`UPDATE idempotency_keys SET created_at = NOW() - INTERVAL '1 hour'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, claimed = claim(1)
+	if claimed || record.Status != 201 || record.Headers["Location"][0] != "/v1/movies/1" || string(record.Body) != "{}" {
+		t.Fatalf("claim after completion: got claimed %t, record %+v; want the stored response", claimed, record)
+	}
+
+	if _, claimed := claim(2); !claimed {
+		t.Fatal("claim by another user: key not claimed")
+	}
+
+	// Once its ttl has run out, a key is claimed as if it had never been used.
+	_, err = db.Exec(`UPDATE idempotency_keys SET expires_at = NOW() - INTERVAL '1 minute'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, claimed := claim(1); !claimed {
+		t.Fatal("claim after the ttl: key not claimed")
+	}
+
+	n, err := m.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d expired keys deleted; want 1", n)
+	}
+}
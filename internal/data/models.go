@@ -12,12 +12,32 @@ var (
 )
 	
 type Models struct {
+	Credit CreditModel
+	Genre GenreModel
+	Idempotency IdempotencyModel
 	Movie MovieModel
+	MovieRevision MovieRevisionModel
+	Person PersonModel
+	Rating RatingModel
+	Review ReviewModel
+	Token TokenModel
+	User UserModel
+	Watchlist WatchlistModel
 }
 
 // For ease of use, we also add a New() method which returns a Models struct containing // the initialized MovieModel.
 func NewModels(db *sql.DB) Models {
 	return Models{
+		Credit: CreditModel{DB:db},
+		Genre: GenreModel{DB:db},
+		Idempotency: IdempotencyModel{DB:db},
 		Movie: MovieModel{DB:db},
+		MovieRevision: MovieRevisionModel{DB:db},
+		Person: PersonModel{DB:db},
+		Rating: RatingModel{DB:db},
+		Review: ReviewModel{DB:db},
+		Token: TokenModel{DB:db},
+		User: UserModel{DB:db},
+		Watchlist: WatchlistModel{DB:db},
 	}
 }
\ No newline at end of file
@@ -1,8 +1,13 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Marsh-sudo/greenlight/internal/validator"
@@ -10,17 +15,86 @@ import (
 )
 
 type Movie struct {
-	ID int64 `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title string `json:"title"`
-	Year int32  `json:"year,omitempty"`
-	Runtime Runtime  `json:"runtime,omitempty"`
-	Genres []string `json:"genres,omitempty"`// Slice of genres for the movie (romance, comedy, etc.)
-	Version int32  `json:"version"`
+	ID int64 `json:"id" xml:"id"`
+	CreatedAt time.Time `json:"-" xml:"-"`
+	Title string `json:"title" xml:"title"`
+	Year int32  `json:"year,omitempty" xml:"year,omitempty"`
+	Runtime Runtime  `json:"runtime,omitempty" xml:"runtime,omitempty"`
+	Genres []string `json:"genres,omitempty" xml:"genres>genre,omitempty"`// Slice of genres for the movie (romance, comedy, etc.)
+	Version int32  `json:"version" xml:"version"`
+	Rating MovieRating `json:"rating" xml:"rating"` // Aggregate of the users' ratings, maintained by the database
+	DeletedAt *time.Time `json:"deleted_at,omitempty" xml:"deleted_at,omitempty"` // Set while the movie is in the trash
 }
 
 type MovieModel struct {
 	DB*sql.DB
+	tx *sql.Tx
+	actor string
+}
+
+// WithTx returns a copy of the model whose queries run inside the given transaction,
+// so that several changes to movies can be made to succeed or fail together. Only
+// NewImport() still starts transactions of its own on the connection pool.
+func (m MovieModel) WithTx(tx *sql.Tx) MovieModel {
+	m.tx = tx
+	return m
+}
+
+// WithActor returns a copy of the model whose changes to movies are recorded in
+// their revisions as made by the given actor.
+func (m MovieModel) WithActor(actor string) MovieModel {
+	m.actor = actor
+	return m
+}
+
+// setActor sets the greenlight.actor setting the revision trigger reads for the rest
+// of the transaction, if the model has an actor.
+func (m MovieModel) setActor(tx DBTX) error {
+	if m.actor == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(`SELECT set_config('greenlight.actor', $1, true)`, m.actor)
+	return err
+}
+
+// transact runs fn, which makes changes to movies, in a transaction with the
+// model's actor set: the one the model was given by WithTx(), if any, and otherwise
+// a new one that is committed if fn succeeds.
+func (m MovieModel) transact(fn func(tx DBTX) error) error {
+	if m.tx != nil {
+		if err := m.setActor(m.tx); err != nil {
+			return err
+		}
+		return fn(m.tx)
+	}
+
+	return RunInTx(m.DB, func(tx *sql.Tx) error {
+		if err := m.setActor(tx); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// write is like transact(), but a change made by a single statement with no actor to
+// record runs straight on the connection pool, without a transaction.
+func (m MovieModel) write(fn func(db DBTX) error) error {
+	if m.tx == nil && m.actor == "" {
+		return fn(m.DB)
+	}
+
+	return m.transact(fn)
+}
+
+// db returns what the model's queries run on: the transaction it was given by
+// WithTx(), if any, and otherwise the connection pool.
+func (m MovieModel) db() DBTX {
+	if m.tx != nil {
+		return m.tx
+	}
+
+	return m.DB
 }
 
 // Define a MovieModel struct type which wraps a sql.DB connection pool.
@@ -36,38 +110,269 @@ func (m MovieModel) Insert(movie *Movie) error{
 	//passing in the args slice as a variadic parameter and scanning the system-generated
 	// id,vreated_at and version values into the movie struct
 
-	return m.DB.QueryRow(query,args...).Scan(&movie.ID,&movie.CreatedAt,&movie.Version)
+	return m.write(func(db DBTX) error {
+		return db.QueryRow(query,args...).Scan(&movie.ID,&movie.CreatedAt,&movie.Version)
+	})
+}
+
+// InsertWithID creates the movie at the id already set on it, instead of one taken
+// from the id sequence. The sequence is then moved past that id if necessary, so that
+// later inserts don't collide with it. If a movie with the id already exists,
+// ErrEditConflict is returned.
+func (m MovieModel) InsertWithID(movie *Movie) error {
+	query := `
+		INSERT INTO movies (id,title,year,runtime,genres)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING created_at,version`
+
+	args := []interface{}{movie.ID,movie.Title,movie.Year,movie.Runtime,pq.Array(movie.Genres)}
+
+	return m.transact(func(tx DBTX) error {
+		err := tx.QueryRow(query,args...).Scan(&movie.CreatedAt,&movie.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err,sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`
+			SELECT setval(seq, GREATEST(pg_sequence_last_value(seq::regclass), $1))
+			FROM pg_get_serial_sequence('movies', 'id') AS seq`, movie.ID)
+		return err
+	})
+}
+
+// MovieImport inserts movies in batches using COPY. An atomic import runs every batch
+// inside one transaction that is only committed by Commit(); otherwise each batch is
+// committed on its own as soon as it has been inserted.
+type MovieImport struct {
+	model MovieModel
+	tx *sql.Tx
+}
+
+func (m MovieModel) NewImport(atomic bool) (*MovieImport, error) {
+	imp := &MovieImport{model: m}
+
+	if atomic {
+		tx, err := m.DB.Begin()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := m.setActor(tx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		imp.tx = tx
+	}
+
+	return imp, nil
+}
+
+// Insert copies a batch of movies into the movies table. COPY can't return the
+// generated ids, so they are taken from the movies id sequence up front and written
+// explicitly, and set on the movie structs once the batch is stored.
+func (imp *MovieImport) Insert(movies []*Movie) error {
+	tx := imp.tx
+	if tx == nil {
+		var err error
+		tx, err = imp.model.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = imp.model.setActor(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(`
+		SELECT nextval(pg_get_serial_sequence('movies', 'id'))
+		FROM generate_series(1, $1)`, len(movies))
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(movies))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("movies", "id", "title", "year", "runtime", "genres"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, movie := range movies {
+		_, err = stmt.Exec(ids[i], movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Calling Exec() with no arguments flushes the buffered rows to the server.
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+
+	if imp.tx == nil {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	for i, movie := range movies {
+		movie.ID = ids[i]
+		movie.Version = 1
+	}
+
+	return nil
+}
+
+// Commit makes an atomic import permanent. It's a no-op for other imports.
+func (imp *MovieImport) Commit() error {
+	if imp.tx == nil {
+		return nil
+	}
+
+	return imp.tx.Commit()
+}
+
+// Rollback discards everything inserted by an atomic import. It's safe to call after
+// Commit(), so it can be deferred.
+func (imp *MovieImport) Rollback() error {
+	if imp.tx == nil {
+		return nil
+	}
+
+	return imp.tx.Rollback()
+}
+
+// movieColumns is the list of columns selected by the queries that read whole movie
+// records, in the order that scanMovie() expects them.
+const movieColumns = `id, created_at, title, year, runtime, genres, version, rating, rating_count, deleted_at`
+
+// scanMovie scans a row made up of movieColumns into the movie, followed by any extra
+// columns the query selected after them.
+func scanMovie(row interface{ Scan(...interface{}) error }, movie *Movie, extra ...interface{}) error {
+	dest := []interface{}{
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.Rating.Average,
+		&movie.Rating.Count,
+		&movie.DeletedAt,
+	}
+
+	return row.Scan(append(dest, extra...)...)
+}
+
+// movieSelection returns the column list for a query selecting only the given fields
+// of a movie, along with a function scanning a row made up of those columns, followed
+// by any extra ones, into a movie. The id is always selected. With no fields, these
+// are movieColumns and scanMovie().
+func movieSelection(fields []string) (string, func(row interface{ Scan(...interface{}) error }, movie *Movie, extra ...interface{}) error) {
+	if len(fields) == 0 {
+		return movieColumns, scanMovie
+	}
+
+	columns := []string{"id"}
+	selected := map[string]bool{"id": true}
+
+	for _, field := range fields {
+		if selected[field] {
+			continue
+		}
+		selected[field] = true
+
+		switch field {
+		case "title", "year", "runtime", "genres", "version", "deleted_at":
+			columns = append(columns, field)
+		case "rating":
+			columns = append(columns, "rating", "rating_count")
+		default:
+			panic("unknown movie field: " + field)
+		}
+	}
+
+	scan := func(row interface{ Scan(...interface{}) error }, movie *Movie, extra ...interface{}) error {
+		dest := make([]interface{}, 0, len(columns)+len(extra))
+
+		for _, column := range columns {
+			switch column {
+			case "id":
+				dest = append(dest, &movie.ID)
+			case "title":
+				dest = append(dest, &movie.Title)
+			case "year":
+				dest = append(dest, &movie.Year)
+			case "runtime":
+				dest = append(dest, &movie.Runtime)
+			case "genres":
+				dest = append(dest, pq.Array(&movie.Genres))
+			case "version":
+				dest = append(dest, &movie.Version)
+			case "rating":
+				dest = append(dest, &movie.Rating.Average)
+			case "rating_count":
+				dest = append(dest, &movie.Rating.Count)
+			case "deleted_at":
+				dest = append(dest, &movie.DeletedAt)
+			}
+		}
+
+		return row.Scan(append(dest, extra...)...)
+	}
+
+	return strings.Join(columns, ", "), scan
 }
 
-// Add a placeholder method for fetching a specific record from the movies table.
-func (m MovieModel) Get(id int64) (*Movie, error) {
+// Get returns the movie with the given id. If any fields are given, only those are
+// read; the others are left with their zero values.
+func (m MovieModel) Get(id int64, fields ...string) (*Movie, error) {
 
 	if id < 1 {
 		return nil ,ErrRecordNotFound
 	}
-	//define the sql query for retrieving the movie data
+	//define the sql query for retrieving the movie data. Movies that have been
+	// moved to the trash are treated as if they don't exist.
+	columns, scan := movieSelection(fields)
+
 	query := `
-		SELECT id, created_at,title,year,runtime,genres,version
+		SELECT ` + columns + `
 		FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 		// Declare a Movie struct to hold the data returned by the query
 		var movie Movie
 
 		// Execute the query using the QueryRow() method, passing in the provided id value
 		 // as a placeholder parameter, and scan the response data into the fields of the
-		// Movie struct. Importantly, notice that we need to convert the scan target for the 
-		// genres column using the pq.Array() adapter function again.
-
-		err := m.DB.QueryRow(query,id).Scan(
-			&movie.ID, 
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+		// Movie struct.
+		err := scan(m.db().QueryRow(query,id), &movie)
 
 		//if there was no matching movie found, Scan() will return
 		// a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
@@ -84,15 +389,651 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		return &movie, nil
 }
 
-// Add a placeholder method for updating a specific record in the movies table.
+// MaxBatchIDs is the most movies that can be fetched by id in one go.
+const MaxBatchIDs = 1000
+
+// ValidateMovieIDs checks a list of movie ids to be fetched together.
+func ValidateMovieIDs(v *validator.Validator, ids []int64) {
+	v.Check(len(ids) > 0, "ids", "must contain at least 1 id")
+	v.Check(len(ids) <= MaxBatchIDs, "ids", fmt.Sprintf("must not contain more than %d ids", MaxBatchIDs))
+
+	seen := make(map[int64]bool, len(ids))
+
+	for _, id := range ids {
+		v.Check(id > 0, "ids", "must only contain positive integers")
+		v.Check(!seen[id], "ids", "must not contain duplicate values")
+		seen[id] = true
+	}
+}
+
+// GetMany returns the movies with the given ids, in the same order as the ids, using a
+// single query. Ids that don't belong to a movie, or belong to one in the trash, are
+// left out. As with Get(), only the given fields are read, if there are any.
+func (m MovieModel) GetMany(ids []int64, fields ...string) ([]*Movie, error) {
+	columns, scan := movieSelection(fields)
+
+	query := `
+		SELECT ` + columns + `
+		FROM movies
+		WHERE id = ANY($1) AND deleted_at IS NULL`
+
+	rows, err := m.db().Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[int64]*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := scan(rows, &movie)
+		if err != nil {
+			return nil, err
+		}
+
+		found[movie.ID] = &movie
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	movies := []*Movie{}
+	for _, id := range ids {
+		if movie, ok := found[id]; ok {
+			movies = append(movies, movie)
+		}
+	}
+
+	return movies, nil
+}
+
+// MovieFilter holds the conditions a listing of movies can be narrowed down by. The
+// zero value of each field matches every movie. The title matches whole words unless
+// FuzzyTitle is set, in which case it matches titles containing something close to it,
+// so that typos are forgiven. Movies have all of the genres unless AnyGenres is set,
+// in which case having one of them is enough. The year and runtime ranges include both
+// ends. The query, if there is one, narrows the listing down further.
+type MovieFilter struct {
+	Title string
+	FuzzyTitle bool
+	Genres []string
+	AnyGenres bool
+	YearMin int32
+	YearMax int32
+	RuntimeMin Runtime
+	RuntimeMax Runtime
+	Query *MovieQuery
+}
+
+// where returns the WHERE conditions for the filter along with the values of their
+// placeholders. Any other placeholders a query has come after these.
+func (f MovieFilter) where() (string, []interface{}) {
+	where, args := movieFilterConditions, f.args()
+
+	if f.Query != nil && len(f.Query.Terms) > 0 {
+		where += "\n\t\tAND " + f.Query.sql(&args)
+	}
+
+	return where, args
+}
+
+// args returns the values of the placeholders in movieFilterConditions. A nil slice
+// would be sent as NULL rather than an empty array, so it is replaced with an empty
+// one.
+func (f MovieFilter) args() []interface{} {
+	genres := f.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+
+	return []interface{}{
+		f.Title,
+		pq.Array(genres),
+		f.AnyGenres,
+		f.YearMin,
+		f.YearMax,
+		f.RuntimeMin,
+		f.RuntimeMax,
+		f.FuzzyTitle,
+	}
+}
+
+// ValidateMovieFilter checks the filter, along with the parts of the listing's sort
+// that depend on it.
+func ValidateMovieFilter(v *validator.Validator, f MovieFilter, filters Filters) {
+	v.Check(f.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(f.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(f.YearMin == 0 || f.YearMax == 0 || f.YearMin <= f.YearMax, "year_max", "must not be less than year_min")
+
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(f.RuntimeMin == 0 || f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+
+	// Relevance is how closely a title matches the one searched for, which isn't
+	// stored anywhere a cursor could refer back to.
+	if filters.sortsBy("relevance") {
+		v.Check(f.Title != "", "sort", "relevance must only be used together with a title")
+		v.Check(filters.Cursor == "", "cursor", "must not be used when sorting by relevance")
+	}
+}
+
+// movieFilterConditions are the WHERE conditions shared by the queries that list
+// movies. They expect the values returned by MovieFilter.args() as $1 to $8. The
+// fuzzy title match uses the pg_trgm word similarity operator, which is true when the
+// title has a run of words that shares enough trigrams with the search.
+//
+// Postgres settles the type of a parameter where it is first used, and lib/pq sends
+// them all untyped, so the genres ($2) are cast to text[] before being compared with
+// the empty array, which would otherwise make them text.
+const movieFilterConditions = `deleted_at IS NULL
+		AND ($1 = ''
+			OR (NOT $8 AND to_tsvector('simple', title) @@ plainto_tsquery('simple', $1))
+			OR ($8 AND $1 <% title))
+		AND ($2::text[] = '{}' OR (NOT $3 AND genres @> $2) OR ($3 AND genres && $2))
+		AND (year >= $4 OR $4 = 0)
+		AND (year <= $5 OR $5 = 0)
+		AND (runtime >= $6 OR $6 = 0)
+		AND (runtime <= $7 OR $7 = 0)`
+
+// moviesAsOf returns a common table expression that stands in for the movies table,
+// with each movie rebuilt from its latest revision matching the conditions, which
+// must limit the revisions to those made up to some point in time. As it's named
+// movies, a query written against the table can follow it unchanged to read the
+// catalog as it was at that time. Movies that were in the trash at the time keep their
+// deleted_at, and movies that had been purged by then have it set too. Snapshots taken
+// before movies had ratings get an empty rating.
+func moviesAsOf(revisionConditions string) string {
+	return fmt.Sprintf(`
+		WITH movies AS (
+			SELECT (jsonb_populate_record(NULL::movies, '{"rating": 0, "rating_count": 0, "rating_sum": 0}'::jsonb || snapshot)).*
+			FROM (
+				SELECT DISTINCT ON (movie_id) snapshot
+				FROM movie_revisions
+				WHERE %s
+				ORDER BY movie_id, version DESC
+			) AS latest
+		)`, revisionConditions)
+}
+
+// GetAsOf returns the movie as it was at the given time, or ErrRecordNotFound if it
+// didn't exist yet or was in the trash at the time. As with Get(), only the given
+// fields are read, if there are any.
+func (m MovieModel) GetAsOf(id int64, asOf time.Time, fields ...string) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	columns, scan := movieSelection(fields)
+
+	query := moviesAsOf("movie_id = $1 AND created_at <= $2") + `
+		SELECT ` + columns + `
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	var movie Movie
+
+	err := scan(m.db().QueryRow(query, id, asOf), &movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// movieSortExpression returns what the movie listings order by for a sort column.
+// That is the column itself, except for relevance, which is how closely the title
+// matches the title filter ($1). It's negated so that an ascending sort puts the
+// closest matches first.
+func movieSortExpression(column string) string {
+	if column == "relevance" {
+		return "-word_similarity($1, title)"
+	}
+
+	return column
+}
+
+// GetAll returns a page of movies matching the filter. Movies in the trash are left
+// out.
+func (m MovieModel) GetAll(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	where, args := filter.where()
+	return m.list("", where, args, filters)
+}
+
+// GetAllAsOf is like GetAll(), but lists the movies as they were at the given time.
+func (m MovieModel) GetAllAsOf(filter MovieFilter, filters Filters, asOf time.Time) ([]*Movie, Metadata, error) {
+	where, args := filter.where()
+	with := moviesAsOf(fmt.Sprintf("created_at <= $%d", len(args)+1))
+	return m.list(with, where, append(args, asOf), filters)
+}
+
+// GetDeleted returns a page of the movies that are in the trash.
+func (m MovieModel) GetDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	return m.list("", "deleted_at IS NOT NULL", nil, filters)
+}
+
+// list returns a page of the movies matching the where conditions, which use the
+// args as their placeholders. Any WITH clause the query needs goes in with. The page
+// is selected either by the page number or, when the filters carry a cursor, by
+// seeking past the last row of the previous page using its sort key and id. The
+// matching movies are counted as the filters' count mode asks.
+func (m MovieModel) list(with string, where string, args []interface{}, filters Filters) ([]*Movie, Metadata, error) {
+	n := len(args)
+
+	estimate := 0
+	if filters.Cursor == "" && filters.Count == "estimated" {
+		var err error
+		estimate, err = m.estimate(with, where, args)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	// Only the fields the filters ask for are selected, along with the sort columns,
+	// which the next cursor is made from.
+	fields := append([]string{}, filters.Fields...)
+	if len(fields) > 0 {
+		for _, key := range parseSort(filters.Sort) {
+			if key.column != "relevance" {
+				fields = append(fields, key.column)
+			}
+		}
+	}
+	columns, scan := movieSelection(fields)
+
+	// The window function makes the database find every matching row, rather than
+	// stopping once it has a page, so it's only used when the count is wanted.
+	count := "0"
+	if filters.counts() {
+		count = "count(*) OVER()"
+	}
+
+	// We fetch one row more than the page size so we know whether there is a next
+	// page to issue a cursor for.
+	args = append(args, filters.limit() + 1, filters.offset())
+
+	// The keyset condition mirrors the ORDER BY clause: rows further along in the sort
+	// order than the last row of the previous page.
+	keyset := ""
+	if filters.Cursor != "" {
+		c, err := decodeCursor(filters.Cursor)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		keyset = "AND " + filters.keyset(c, &args)
+	}
+
+	query := fmt.Sprintf(`%s
+		SELECT %s, %s
+		FROM movies
+		WHERE %s
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, with, columns, count, where, keyset, filters.orderBy(movieSortExpression, "id"), n+1, n+2)
+
+	rows, err := m.db().Query(query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := scan(rows, &movie, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var metadata Metadata
+
+	switch {
+	case filters.counts():
+		metadata = calculateMetadata(filters, totalRecords)
+	case filters.Cursor != "":
+		metadata = calculateMetadata(filters, 0)
+	case filters.Count == "estimated":
+		metadata = calculateMetadata(filters, estimate)
+		metadata.Estimated = estimate > 0
+	default:
+		metadata = Metadata{CurrentPage: filters.Page, PageSize: filters.PageSize, FirstPage: 1}
+	}
+
+	if filters.Cursor == "" && filters.Page > 1 {
+		metadata.PrevPage = filters.Page - 1
+	}
+
+	if len(movies) > filters.limit() {
+		movies = movies[:filters.limit()]
+		last := movies[len(movies)-1]
+
+		if filters.Cursor == "" {
+			metadata.NextPage = filters.Page + 1
+		}
+
+		// There's no cursor for a relevance sort; see ValidateMovieFilter().
+		if !filters.sortsBy("relevance") {
+			c := cursor{Sort: filters.Sort, ID: last.ID}
+			for _, key := range filters.sortKeys() {
+				c.Values = append(c.Values, last.sortValue(key.column))
+			}
+			metadata.NextCursor = encodeCursor(c)
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+// estimate returns the query planner's estimate of the number of movies matching the
+// where conditions. It only costs planning the query, however many movies there are,
+// but it can be some way off, particularly for conditions the planner has no
+// statistics for.
+func (m MovieModel) estimate(with string, where string, args []interface{}) (int, error) {
+	query := fmt.Sprintf(`EXPLAIN (FORMAT JSON) %s
+		SELECT 1
+		FROM movies
+		WHERE %s`, with, where)
+
+	var js []byte
+
+	err := m.db().QueryRow(query, args...).Scan(&js)
+	if err != nil {
+		return 0, err
+	}
+
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+
+	err = json.Unmarshal(js, &plan)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(plan) == 0 {
+		return 0, errors.New("empty query plan")
+	}
+
+	return int(plan[0].Plan.Rows), nil
+}
+
+// SuggestTitles returns up to five titles of movies close to the given one, closest
+// first. It's used to offer alternatives when a search by title finds nothing, so it
+// casts a wider net than the fuzzy title filter does.
+func (m MovieModel) SuggestTitles(title string) ([]string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lowering the threshold of the <% operator for this transaction only lets the
+	// query use the trigram index, rather than comparing the title with every movie.
+	_, err = tx.Exec(`SELECT set_config('pg_trgm.word_similarity_threshold', '0.3', true)`)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT title
+		FROM movies
+		WHERE deleted_at IS NULL AND $1 <% title
+		GROUP BY title
+		ORDER BY max(word_similarity($1, title)) DESC, title
+		LIMIT 5`
+
+	rows, err := tx.Query(query, title)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []string{}
+
+	for rows.Next() {
+		var t string
+
+		err := rows.Scan(&t)
+		if err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// Export calls fn for every movie matching the filter, in the order
+// given by the filters' sort. Rows are read through a server-side cursor a batch at a
+// time, so memory use doesn't depend on the size of the table. If fn returns an error
+// the export stops and that error is returned. It also stops once ctx is done, such as
+// when the client has gone away, rather than reading the rest of the table.
+func (m MovieModel) Export(ctx context.Context, filter MovieFilter, filters Filters, fn func(*Movie) error) error {
+	// Cursors only live as long as the transaction they are declared in.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := filter.where()
+
+	query := fmt.Sprintf(`
+		DECLARE movie_export NO SCROLL CURSOR FOR
+		SELECT %s
+		FROM movies
+		WHERE %s
+		ORDER BY %s`, movieColumns, where, filters.orderBy(movieSortExpression, "id"))
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		rows, err := tx.QueryContext(ctx, `FETCH FORWARD 500 FROM movie_export`)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+
+		for rows.Next() {
+			var movie Movie
+
+			err := scanMovie(rows, &movie)
+			if err == nil {
+				err = fn(&movie)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			fetched++
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if fetched == 0 {
+			return nil
+		}
+	}
+}
+
+// sortValue returns the value of the given sort column for the movie, in the text form
+// that is stored in a cursor.
+func (movie *Movie) sortValue(column string) string {
+	switch column {
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.FormatInt(int64(movie.Year), 10)
+	case "runtime":
+		return strconv.FormatInt(int64(movie.Runtime), 10)
+	case "rating":
+		return strconv.FormatFloat(movie.Rating.Average, 'f', 2, 64)
+	case "deleted_at":
+		return movie.DeletedAt.Format(time.RFC3339Nano)
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
+}
+
+// Update saves the movie's title, year, runtime and genres. The update only goes
+// ahead if the version number in the database still matches the one on the movie,
+// so that two clients editing the same movie can't silently overwrite each other.
+// If the version has moved on, ErrEditConflict is returned.
 func (m MovieModel) Update(movie *Movie) error {
+	query := `
+		UPDATE movies
+		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+		WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+		RETURNING version`
+
+	args := []interface{}{
+		movie.Title,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+		movie.ID,
+		movie.Version,
+	}
+
+	// No matching row means the movie was either deleted or edited since it was
+	// fetched, both of which we treat as an edit conflict.
+	err := m.write(func(db DBTX) error {
+		return db.QueryRow(query, args...).Scan(&movie.Version)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Delete moves the movie to the trash by setting its deleted_at time, rather than
+// removing the row, so that it can be restored later. Rows stay in the trash until
+// they are purged. If there is no movie with the id outside the trash,
+// ErrRecordNotFound is returned.
 func (m MovieModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	var result sql.Result
+
+	err := m.write(func(db DBTX) error {
+		var err error
+		result, err = db.Exec(query, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
 }
 
+// Restore takes the movie back out of the trash. The version is bumped, so that any
+// edits prepared against the movie before it was deleted are rejected. If there is no
+// movie with the id in the trash, ErrRecordNotFound is returned.
+func (m MovieModel) Restore(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING ` + movieColumns
+
+	var movie Movie
+
+	err := m.write(func(db DBTX) error {
+		return scanMovie(db.QueryRow(query, id), &movie)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// Purge permanently deletes the movies that have been in the trash for longer than
+// the retention period, and returns how many were deleted.
+func (m MovieModel) Purge(retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM movies
+		WHERE deleted_at < $1`
+
+	var result sql.Result
+
+	err := m.write(func(db DBTX) error {
+		var err error
+		result, err = db.Exec(query, time.Now().Add(-retention))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/testdb"
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+var testSortSafelist = []string{"id", "title", "year", "runtime", "rating", "relevance", "-id", "-title", "-year", "-runtime", "-rating"}
+
+var testFieldSafelist = []string{"id", "title", "year", "runtime", "genres", "version", "rating"}
+
+func insertTestMovies(t *testing.T, m MovieModel) map[string]int64 {
+	t.Helper()
+
+	movies := []*Movie{
+		{Title: "The Godfather", Year: 1972, Runtime: 175, Genres: []string{"crime", "drama"}},
+		{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"action", "crime", "drama"}},
+		{Title: "Toy Story", Year: 1995, Runtime: 81, Genres: []string{"animation", "comedy", "family"}},
+		{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+		{Title: "The Godfather Part II", Year: 1974, Runtime: 202, Genres: []string{"crime", "drama"}},
+	}
+
+	ids := make(map[string]int64)
+	for _, movie := range movies {
+		if err := m.Insert(movie); err != nil {
+			t.Fatal(err)
+		}
+		ids[movie.Title] = movie.ID
+	}
+
+	return ids
+}
+
+func movieTitles(movies []*Movie) []string {
+	titles := []string{}
+	for _, movie := range movies {
+		titles = append(titles, movie.Title)
+	}
+	return titles
+}
+
+// TestMovieListing runs the listing queries against a real database, where mistakes
+// in the SQL, such as a parameter Postgres can't settle the type of, show up. The
+// filter conditions are shared by the listing, the facets, the export and the
+// watchlist, so each of them is run.
+func TestMovieListing(t *testing.T) {
+	db := testdb.Open(t)
+	models := NewModels(db)
+
+	ids := insertTestMovies(t, models.Movie)
+
+	filters := func(sort string) Filters {
+		return Filters{
+			Page: 1,
+			PageSize: 20,
+			Sort: sort,
+			SortSafelist: testSortSafelist,
+			Count: "exact",
+			FieldSafelist: testFieldSafelist,
+		}
+	}
+
+	query := func(s string) *MovieQuery {
+		v := validator.New()
+		q := ParseMovieQuery(v, "q", s)
+		if !v.Valid() {
+			t.Fatalf("ParseMovieQuery(%q): %v", s, v.Errors)
+		}
+		return q
+	}
+
+	tests := []struct {
+		name string
+		filter MovieFilter
+		sort string
+		want []string
+	}{
+		{"no filter", MovieFilter{}, "id", []string{"The Godfather", "Heat", "Toy Story", "Alien", "The Godfather Part II"}},
+		{"all genres", MovieFilter{Genres: []string{"crime", "action"}}, "id", []string{"Heat"}},
+		{"any genre", MovieFilter{Genres: []string{"action", "sci-fi"}, AnyGenres: true}, "id", []string{"Heat", "Alien"}},
+		{"title", MovieFilter{Title: "godfather"}, "id", []string{"The Godfather", "The Godfather Part II"}},
+		{"fuzzy title", MovieFilter{Title: "godfathr", FuzzyTitle: true}, "relevance", []string{"The Godfather", "The Godfather Part II"}},
+		{"year range", MovieFilter{YearMin: 1970, YearMax: 1979}, "year", []string{"The Godfather", "The Godfather Part II", "Alien"}},
+		{"runtime range", MovieFilter{RuntimeMin: 100, RuntimeMax: 180}, "-runtime", []string{"The Godfather", "Heat", "Alien"}},
+		{"query", MovieFilter{Query: query(`genre:drama -"part ii" year:<1980`)}, "id", []string{"The Godfather"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movies, metadata, err := models.Movie.GetAll(tt.filter, filters(tt.sort))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := movieTitles(movies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+			if metadata.TotalRecords != len(tt.want) {
+				t.Errorf("got %d total records; want %d", metadata.TotalRecords, len(tt.want))
+			}
+		})
+	}
+
+	t.Run("count modes", func(t *testing.T) {
+		for _, count := range []string{"estimated", "none"} {
+			f := filters("id")
+			f.Count = count
+
+			movies, _, err := models.Movie.GetAll(MovieFilter{Genres: []string{"drama"}}, f)
+			if err != nil {
+				t.Fatalf("count %s: %v", count, err)
+			}
+			if len(movies) != 3 {
+				t.Errorf("count %s: got %d movies; want 3", count, len(movies))
+			}
+		}
+	})
+
+	t.Run("cursor", func(t *testing.T) {
+		f := filters("-year,-title")
+		f.PageSize = 2
+
+		var got []string
+		for i := 0; i < 5; i++ {
+			movies, metadata, err := models.Movie.GetAll(MovieFilter{}, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(got, movieTitles(movies)...)
+			if metadata.NextCursor == "" {
+				break
+			}
+			f.Cursor = metadata.NextCursor
+		}
+
+		want := []string{"Toy Story", "Heat", "Alien", "The Godfather Part II", "The Godfather"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		f := filters("id")
+		f.Fields = []string{"id", "title"}
+
+		movies, _, err := models.Movie.GetAll(MovieFilter{Genres: []string{"sci-fi"}}, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(movies) != 1 || movies[0].Title != "Alien" || movies[0].Year != 0 {
+			t.Errorf("got %+v; want only the id and title of Alien", movies)
+		}
+
+		movie, err := models.Movie.Get(ids["Alien"], "year")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if movie.ID != ids["Alien"] || movie.Year != 1979 || movie.Title != "" {
+			t.Errorf("got %+v; want only the id and year of Alien", movie)
+		}
+	})
+
+	t.Run("facets", func(t *testing.T) {
+		facets, err := models.Movie.Facets(MovieFilter{Genres: []string{"crime"}}, FacetNames)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts := make(map[string]int)
+		for _, fc := range facets["genres"] {
+			counts[fc.Value] = fc.Count
+		}
+		if counts["drama"] != 3 || counts["action"] != 1 {
+			t.Errorf("got genre counts %v; want drama 3 and action 1", counts)
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		var got []string
+		err := models.Movie.Export(context.Background(), MovieFilter{Genres: []string{"drama"}}, filters("title"), func(movie *Movie) error {
+			got = append(got, movie.Title)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"Heat", "The Godfather", "The Godfather Part II"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	})
+
+	t.Run("watchlist", func(t *testing.T) {
+		user := &User{Name: "Alice", Email: "alice@example.com"}
+		if err := models.User.Insert(user); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, title := range []string{"Heat", "Toy Story"} {
+			if _, err := models.Watchlist.Upsert(user.ID, &WatchlistEntry{MovieID: ids[title]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		entries, _, err := models.Watchlist.GetAll(user.ID, MovieFilter{Genres: []string{"crime"}}, filters("id"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || entries[0].Movie.Title != "Heat" {
+			t.Errorf("got %d entries; want just Heat", len(entries))
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// A MovieQuery is a parsed search query, as typed into a search box. It is made of
+// terms separated by spaces, all of which a movie has to match:
+//
+//	godfather             a word in the title
+//	"the godfather"       a phrase in the title
+//	title:godfather       the same as a bare word (or title:"..." for a phrase)
+//	genre:drama           a genre
+//	year:1972             a year, or year:>1990, year:>=1990, year:<2000, year:<=2000
+//	year:1990..1999       a range of years, including both ends
+//	runtime:<120          the same comparisons and ranges for the runtime in minutes
+//
+// A term starting with a hyphen, like -genre:horror, matches the movies that don't
+// match the rest of the term. Only those four names are fields, so any other word with
+// a colon in it, such as Mission:Impossible, is an ordinary word.
+type MovieQuery struct {
+	Terms []QueryTerm
+}
+
+// A QueryTerm is one of TextTerm, GenreTerm or CompareTerm. Pos is the position of
+// the term in the query, counting characters from 1, which error messages refer to.
+type QueryTerm interface {
+	// sql returns the term's condition, adding its values to args and referring to
+	// them by their placeholders. Nothing the client typed goes in the condition.
+	sql(args *[]interface{}) string
+}
+
+// A TextTerm matches the words of the title, in order if it is a phrase.
+type TextTerm struct {
+	Pos int
+	Negated bool
+	Text string
+	Phrase bool
+}
+
+// A GenreTerm matches movies with the genre.
+type GenreTerm struct {
+	Pos int
+	Negated bool
+	Genre string
+}
+
+// A CompareTerm compares the year or runtime with a value, using one of the operators
+// "=", "<", "<=", ">" or ">=", or with a range from Value to Max using "..".
+type CompareTerm struct {
+	Pos int
+	Negated bool
+	Field string
+	Op string
+	Value int32
+	Max int32
+}
+
+// queryColumns maps the fields that can be compared to their columns.
+var queryColumns = map[string]string{
+	"year": "year",
+	"runtime": "runtime",
+}
+
+// placeholder adds the value to args and returns the placeholder referring to it.
+func placeholder(args *[]interface{}, value interface{}) string {
+	*args = append(*args, value)
+	return "$" + strconv.Itoa(len(*args))
+}
+
+func negate(negated bool, condition string) string {
+	if negated {
+		return "NOT (" + condition + ")"
+	}
+	return condition
+}
+
+func (t TextTerm) sql(args *[]interface{}) string {
+	fn := "plainto_tsquery"
+	if t.Phrase {
+		fn = "phraseto_tsquery"
+	}
+
+	return negate(t.Negated, fmt.Sprintf("to_tsvector('simple', title) @@ %s('simple', %s)", fn, placeholder(args, t.Text)))
+}
+
+func (t GenreTerm) sql(args *[]interface{}) string {
+	return negate(t.Negated, fmt.Sprintf("genres @> ARRAY[%s::text]", placeholder(args, t.Genre)))
+}
+
+func (t CompareTerm) sql(args *[]interface{}) string {
+	column := queryColumns[t.Field]
+
+	var condition string
+	switch t.Op {
+	case "..":
+		condition = fmt.Sprintf("%s BETWEEN %s AND %s", column, placeholder(args, t.Value), placeholder(args, t.Max))
+	case "=", "<", "<=", ">", ">=":
+		condition = fmt.Sprintf("%s %s %s", column, t.Op, placeholder(args, t.Value))
+	default:
+		panic("unknown comparison operator: " + t.Op)
+	}
+
+	return negate(t.Negated, condition)
+}
+
+// sql returns the query's conditions joined with AND, or an empty string if it has no
+// terms.
+func (q *MovieQuery) sql(args *[]interface{}) string {
+	conditions := make([]string, len(q.Terms))
+	for i, term := range q.Terms {
+		conditions[i] = term.sql(args)
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// CanonicalGenres replaces the genres in the query's genre terms with their slugs, as
+// GenreVocabulary.Canonical() does for the genres filter.
+func (q *MovieQuery) CanonicalGenres(vocab GenreVocabulary) {
+	for i, term := range q.Terms {
+		if t, ok := term.(GenreTerm); ok {
+			t.Genre = vocab.Canonical([]string{t.Genre})[0]
+			q.Terms[i] = t
+		}
+	}
+}
+
+// ParseMovieQuery parses the query typed by the client. Mistakes are recorded in the
+// validator under the key, with the position of the term they were found in. The
+// query returned is only meaningful if there were none.
+func ParseMovieQuery(v *validator.Validator, key string, s string) *MovieQuery {
+	q := &MovieQuery{}
+
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		v.AddError(key, err.Error())
+		return q
+	}
+
+	for _, tok := range tokens {
+		term, err := parseQueryTerm(tok)
+		if err != nil {
+			v.AddError(key, fmt.Sprintf("at position %d: %s", tok.pos, err))
+			continue
+		}
+
+		q.Terms = append(q.Terms, term)
+	}
+
+	v.Check(len(q.Terms) <= 20, key, "must not contain more than 20 terms")
+
+	return q
+}
+
+// queryFields are the field names a query term can start with.
+var queryFields = []string{"title", "genre", "year", "runtime"}
+
+// A queryToken is one space separated term of the query, with any quotes removed. The
+// field is empty for a bare word or phrase. quoted reports whether the value was in
+// quotes.
+type queryToken struct {
+	pos int
+	negated bool
+	field string
+	value string
+	quoted bool
+}
+
+func tokenizeQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		tok := queryToken{pos: i + 1}
+
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			tok.negated = true
+			i++
+		}
+
+		// A field is one of the queryFields followed by a colon and then a value. A
+		// word that just happens to end with a colon, or that starts with some other
+		// word and a colon, like a URL, is a word.
+		j := i
+		for j < len(runes) && unicode.IsLetter(runes[j]) {
+			j++
+		}
+		if j > i && j+1 < len(runes) && runes[j] == ':' && !unicode.IsSpace(runes[j+1]) {
+			if field := strings.ToLower(string(runes[i:j])); validator.In(field, queryFields...) {
+				tok.field = field
+				i = j + 1
+			}
+		}
+
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("at position %d: the quote is never closed", i+1)
+			}
+
+			tok.value = string(runes[i+1 : end])
+			tok.quoted = true
+			i = end + 1
+
+			if i < len(runes) && !unicode.IsSpace(runes[i]) {
+				return nil, fmt.Errorf("at position %d: a closing quote must be followed by a space", i+1)
+			}
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+
+			tok.value = string(runes[i:end])
+			i = end
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	return tokens, nil
+}
+
+func parseQueryTerm(tok queryToken) (QueryTerm, error) {
+	if strings.TrimSpace(tok.value) == "" {
+		return nil, fmt.Errorf("empty value")
+	}
+	if utf8.RuneCountInString(tok.value) > 200 {
+		return nil, fmt.Errorf("value must not be more than 200 characters long")
+	}
+
+	switch tok.field {
+	case "genre":
+		return GenreTerm{Pos: tok.pos, Negated: tok.negated, Genre: tok.value}, nil
+
+	case "year", "runtime":
+		if tok.quoted {
+			return nil, fmt.Errorf("%s must be a number, not a quoted value", tok.field)
+		}
+
+		term := CompareTerm{Pos: tok.pos, Negated: tok.negated, Field: tok.field}
+
+		if lo, hi, ok := strings.Cut(tok.value, ".."); ok {
+			min, err := parseQueryNumber(tok.field, lo)
+			if err != nil {
+				return nil, err
+			}
+			max, err := parseQueryNumber(tok.field, hi)
+			if err != nil {
+				return nil, err
+			}
+			if min > max {
+				return nil, fmt.Errorf("the start of the %s range must not be after its end", tok.field)
+			}
+
+			term.Op, term.Value, term.Max = "..", min, max
+			return term, nil
+		}
+
+		value := tok.value
+		term.Op = "="
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(value, op) {
+				term.Op, value = op, strings.TrimPrefix(value, op)
+				break
+			}
+		}
+
+		n, err := parseQueryNumber(tok.field, value)
+		if err != nil {
+			return nil, err
+		}
+
+		term.Value = n
+		return term, nil
+
+	default:
+		return TextTerm{Pos: tok.pos, Negated: tok.negated, Text: tok.value, Phrase: tok.quoted}, nil
+	}
+}
+
+func parseQueryNumber(field, s string) (int32, error) {
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a whole number, not %q", field, s)
+	}
+
+	return int32(n), nil
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+func TestTokenizeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want []queryToken
+	}{
+		{"", nil},
+		{"  godfather  ", []queryToken{{pos: 3, value: "godfather"}}},
+		{`"the godfather" heat`, []queryToken{{pos: 1, value: "the godfather", quoted: true}, {pos: 17, value: "heat"}}},
+		{"-genre:Horror", []queryToken{{pos: 1, negated: true, field: "genre", value: "Horror"}}},
+		{`Title:"part ii"`, []queryToken{{pos: 1, field: "title", value: "part ii", quoted: true}}},
+		{"year:>=1990", []queryToken{{pos: 1, field: "year", value: ">=1990"}}},
+		{"note: - x", []queryToken{{pos: 1, value: "note:"}, {pos: 7, value: "-"}, {pos: 9, value: "x"}}},
+		{"title:a:b", []queryToken{{pos: 1, field: "title", value: "a:b"}}},
+		{"Mission:Impossible", []queryToken{{pos: 1, value: "Mission:Impossible"}}},
+		{"-https://example.com/heat", []queryToken{{pos: 1, negated: true, value: "https://example.com/heat"}}},
+		{"été", []queryToken{{pos: 1, value: "été"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := tokenizeQuery(tt.query)
+		if err != nil {
+			t.Errorf("tokenizeQuery(%q): unexpected error: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenizeQuery(%q) = %+v; want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want string
+	}{
+		{`heat "the godfather`, "at position 6: the quote is never closed"},
+		{`"heat"x`, "at position 7: a closing quote must be followed by a space"},
+	}
+
+	for _, tt := range tests {
+		_, err := tokenizeQuery(tt.query)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("tokenizeQuery(%q) error = %v; want %q", tt.query, err, tt.want)
+		}
+	}
+}
+
+func TestParseMovieQuery(t *testing.T) {
+	v := validator.New()
+	q := ParseMovieQuery(v, "q", `godfather "part ii" -genre:horror year:1970..1979 runtime:<120 year:2000`)
+	if !v.Valid() {
+		t.Fatalf("unexpected errors: %v", v.Errors)
+	}
+
+	want := []QueryTerm{
+		TextTerm{Pos: 1, Text: "godfather"},
+		TextTerm{Pos: 11, Text: "part ii", Phrase: true},
+		GenreTerm{Pos: 21, Negated: true, Genre: "horror"},
+		CompareTerm{Pos: 35, Field: "year", Op: "..", Value: 1970, Max: 1979},
+		CompareTerm{Pos: 51, Field: "runtime", Op: "<", Value: 120},
+		CompareTerm{Pos: 64, Field: "year", Op: "=", Value: 2000},
+	}
+	if !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("got terms %+v; want %+v", q.Terms, want)
+	}
+
+	var args []interface{}
+	sql := q.sql(&args)
+
+	wantSQL := strings.Join([]string{
+		"to_tsvector('simple', title) @@ plainto_tsquery('simple', $1)",
+		"to_tsvector('simple', title) @@ phraseto_tsquery('simple', $2)",
+		"NOT (genres @> ARRAY[$3::text])",
+		"year BETWEEN $4 AND $5",
+		"runtime < $6",
+		"year = $7",
+	}, " AND ")
+	if sql != wantSQL {
+		t.Errorf("got SQL %q; want %q", sql, wantSQL)
+	}
+
+	wantArgs := []interface{}{"godfather", "part ii", "horror", int32(1970), int32(1979), int32(120), int32(2000)}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("got args %v; want %v", args, wantArgs)
+	}
+}
+
+func TestParseMovieQueryColonWords(t *testing.T) {
+	v := validator.New()
+	q := ParseMovieQuery(v, "q", `Mission:Impossible rating:5 genre:action`)
+	if !v.Valid() {
+		t.Fatalf("unexpected errors: %v", v.Errors)
+	}
+
+	want := []QueryTerm{
+		TextTerm{Pos: 1, Text: "Mission:Impossible"},
+		TextTerm{Pos: 20, Text: "rating:5"},
+		GenreTerm{Pos: 29, Genre: "action"},
+	}
+	if !reflect.DeepEqual(q.Terms, want) {
+		t.Errorf("got terms %+v; want %+v", q.Terms, want)
+	}
+}
+
+func TestParseMovieQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want string
+	}{
+		{`"unclosed`, "at position 1: the quote is never closed"},
+		{`year:"1990"`, "at position 1: year must be a number, not a quoted value"},
+		{"year:199x", `at position 1: year must be a whole number, not "199x"`},
+		{"runtime:>-5", `at position 1: runtime must be a whole number, not "-5"`},
+		{"year:2000..1990", "at position 1: the start of the year range must not be after its end"},
+		{`heat ""`, "at position 6: empty value"},
+		{"a b c d e f g h i j k l m n o p q r s t u", "must not contain more than 20 terms"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ParseMovieQuery(v, "q", tt.query)
+
+		if got := v.Errors["q"]; got != tt.want {
+			t.Errorf("ParseMovieQuery(%q) error = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// A Rating is one user's score for one movie. The average and count of a movie's
+// ratings are kept up to date on the movie itself (see MovieRating) by a trigger on
+// the ratings table.
+type Rating struct {
+	UserID int64 `json:"user_id" xml:"user_id"`
+	MovieID int64 `json:"movie_id" xml:"movie_id"`
+	Score int16 `json:"score" xml:"score"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// MovieRating is the aggregate of a movie's ratings. The average is 0 for a movie
+// that hasn't been rated.
+type MovieRating struct {
+	Average float64 `json:"average" xml:"average"`
+	Count int32 `json:"count" xml:"count"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Score >= 1, "score", "must be at least 1")
+	v.Check(rating.Score <= 10, "score", "must not be more than 10")
+}
+
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// Upsert saves the user's rating of the movie, replacing their previous rating if
+// they had one.
+func (m RatingModel) Upsert(rating *Rating) error {
+	query := `
+		INSERT INTO ratings (user_id, movie_id, score)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, movie_id) DO UPDATE
+		SET score = EXCLUDED.score, updated_at = NOW()
+		RETURNING created_at, updated_at`
+
+	return m.DB.QueryRow(query, rating.UserID, rating.MovieID, rating.Score).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+}
+
+// Delete removes the user's rating of the movie, or returns ErrRecordNotFound if they
+// haven't rated it.
+func (m RatingModel) Delete(userID, movieID int64) error {
+	query := `
+		DELETE FROM ratings
+		WHERE user_id = $1 AND movie_id = $2`
+
+	result, err := m.DB.Exec(query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// The moderation states of a review. New and edited reviews are pending until an
+// admin approves or rejects them, and only approved reviews are shown to everyone.
+const (
+	ReviewPending = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// ReviewStatuses lists the moderation states, for validating them.
+var ReviewStatuses = []string{ReviewPending, ReviewApproved, ReviewRejected}
+
+// ReviewProfanityList holds the words that aren't allowed in reviews. Words that are
+// also names or turn up in titles, such as dick in Moby Dick, are left out, so that a
+// review can name the movie it is about.
+var ReviewProfanityList = []string{
+	"arsehole",
+	"asshole",
+	"bastard",
+	"bitch",
+	"bollocks",
+	"cunt",
+	"fuck",
+	"fucking",
+	"motherfucker",
+	"shit",
+	"twat",
+	"wanker",
+}
+
+type Review struct {
+	ID int64 `json:"id" xml:"id"`
+	MovieID int64 `json:"movie_id" xml:"movie_id"`
+	UserID int64 `json:"user_id" xml:"user_id"`
+	Body string `json:"body" xml:"body"`
+	Status string `json:"status" xml:"status"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
+	Version int32 `json:"version" xml:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Body != "", "body", "must be provided")
+	v.Check(len([]rune(review.Body)) >= 10, "body", "must be at least 10 characters long")
+	v.Check(len([]rune(review.Body)) <= 5000, "body", "must not be more than 5000 characters long")
+	v.Check(!validator.ContainsWord(review.Body, ReviewProfanityList...), "body", "must not contain profanity")
+
+	v.Check(validator.In(review.Status, ReviewStatuses...), "status", "must be one of pending, approved or rejected")
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// reviewColumns is the list of columns selected by the queries that read reviews.
+const reviewColumns = "id, movie_id, user_id, body, status, created_at, updated_at, version"
+
+func scanReview(row interface{ Scan(...interface{}) error }, review *Review, extra ...interface{}) error {
+	dest := []interface{}{
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.Body,
+		&review.Status,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	}
+
+	return row.Scan(append(dest, extra...)...)
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (movie_id, user_id, body, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+
+	args := []interface{}{review.MovieID, review.UserID, review.Body, review.Status}
+
+	return m.DB.QueryRow(query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+}
+
+func (m ReviewModel) Get(id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + reviewColumns + `
+		FROM reviews
+		WHERE id = $1`
+
+	var review Review
+
+	err := scanReview(m.DB.QueryRow(query, id), &review)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+// GetAllForMovie returns a page of the movie's approved reviews, together with any of
+// the viewer's own reviews whatever their state, so that authors can see the reviews
+// they are waiting on. Anonymous viewers have a viewerID of 0 and only see approved
+// reviews.
+func (m ReviewModel) GetAllForMovie(movieID, viewerID int64, filters Filters) ([]*Review, Metadata, error) {
+	where := "movie_id = $1 AND (status = 'approved' OR user_id = $2)"
+	return m.list(where, []interface{}{movieID, viewerID}, filters)
+}
+
+// GetAllWithStatus returns a page of the reviews of all movies in the given state. It
+// is used to work through the moderation queue.
+func (m ReviewModel) GetAllWithStatus(status string, filters Filters) ([]*Review, Metadata, error) {
+	return m.list("status = $1", []interface{}{status}, filters)
+}
+
+func (m ReviewModel) list(where string, args []interface{}, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, count(*) OVER()
+		FROM reviews
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, reviewColumns, where, filters.orderBy(nil, "id"), len(args)+1, len(args)+2)
+
+	rows, err := m.DB.Query(query, append(args, filters.limit(), filters.offset())...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := scanReview(rows, &review, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return reviews, calculateMetadata(filters, totalRecords), nil
+}
+
+// Update saves the review's body and status, as long as the review is still at the
+// version that was read. Otherwise ErrEditConflict is returned.
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET body = $1, status = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING updated_at, version`
+
+	args := []interface{}{review.Body, review.Status, review.ID, review.Version}
+
+	err := m.DB.QueryRow(query, args...).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM reviews
+		WHERE id = $1`
+
+	result, err := m.DB.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
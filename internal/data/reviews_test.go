@@ -0,0 +1,28 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+func TestValidateReviewProfanity(t *testing.T) {
+	tests := []struct {
+		body string
+		valid bool
+	}{
+		{"Moby Dick is long, but worth it.", true},
+		{"Better than Kick-Arse, if you like that sort of thing.", true},
+		{"The ending is utter shit.", false},
+		{"What a load of Bollocks.", false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateReview(v, &Review{Body: tt.body, Status: ReviewPending})
+
+		if v.Valid() != tt.valid {
+			t.Errorf("ValidateReview(%q): got valid %t; want %t (errors %v)", tt.body, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A MovieRevision is the state of a movie right after one change to it. Revisions are
+// written by a trigger on the movies table (see the migrations), never by the models.
+// The operation is one of "insert", "update", "delete", "restore" or "purge", or
+// "snapshot" for the revisions recorded when the history was first set up.
+type MovieRevision struct {
+	MovieID int64 `json:"movie_id" xml:"movie_id"`
+	Version int32 `json:"version" xml:"version"`
+	Operation string `json:"operation" xml:"operation"`
+	Actor string `json:"actor,omitempty" xml:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	Movie *Movie `json:"movie" xml:"movie"`
+}
+
+// movieSnapshot matches the JSON the trigger stores for a movies row. It differs from
+// a Movie's own JSON in that the runtime is a plain number.
+type movieSnapshot struct {
+	ID int64 `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Title string `json:"title"`
+	Year int32 `json:"year"`
+	Runtime int32 `json:"runtime"`
+	Genres []string `json:"genres"`
+	Version int32 `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+func (s movieSnapshot) movie() *Movie {
+	return &Movie{
+		ID: s.ID,
+		CreatedAt: s.CreatedAt,
+		Title: s.Title,
+		Year: s.Year,
+		Runtime: Runtime(s.Runtime),
+		Genres: s.Genres,
+		Version: s.Version,
+		DeletedAt: s.DeletedAt,
+	}
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+// revisionColumns is the list of columns selected by the queries that read revisions,
+// in the order that scanRevision() expects them.
+const revisionColumns = `movie_id, version, operation, snapshot, COALESCE(actor, ''), created_at`
+
+func scanRevision(row interface{ Scan(...interface{}) error }, revision *MovieRevision, extra ...interface{}) error {
+	var snapshot []byte
+
+	dest := []interface{}{
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Operation,
+		&snapshot,
+		&revision.Actor,
+		&revision.CreatedAt,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	var s movieSnapshot
+
+	err = json.Unmarshal(snapshot, &s)
+	if err != nil {
+		return fmt.Errorf("decoding snapshot of movie %d version %d: %w", revision.MovieID, revision.Version, err)
+	}
+
+	revision.Movie = s.movie()
+	return nil
+}
+
+// GetAll returns a page of the movie's revisions, ordered by version.
+func (m MovieRevisionModel) GetAll(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, count(*) OVER()
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY %s
+		LIMIT $2 OFFSET $3`, revisionColumns, filters.orderBy(nil, "version"))
+
+	rows, err := m.DB.Query(query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var revision MovieRevision
+
+		err := scanRevision(rows, &revision, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return revisions, calculateMetadata(filters, totalRecords), nil
+}
+
+// Get returns a single revision of the movie, or ErrRecordNotFound if the movie has
+// no such version.
+func (m MovieRevisionModel) Get(movieID int64, version int32) (*MovieRevision, error) {
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2`
+
+	var revision MovieRevision
+
+	err := scanRevision(m.DB.QueryRow(query, movieID, version), &revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
+
+// A FieldChange describes one field that differs between two revisions of a movie.
+type FieldChange struct {
+	Field string `json:"field" xml:"field"`
+	From interface{} `json:"from" xml:"from"`
+	To interface{} `json:"to" xml:"to"`
+}
+
+// DiffRevisions lists the fields of the movie that changed between the two revisions.
+// Only the fields clients can see are compared; the version always differs.
+func DiffRevisions(from, to *MovieRevision) []FieldChange {
+	changes := []FieldChange{}
+
+	a, b := from.Movie, to.Movie
+
+	if a.Title != b.Title {
+		changes = append(changes, FieldChange{"title", a.Title, b.Title})
+	}
+	if a.Year != b.Year {
+		changes = append(changes, FieldChange{"year", a.Year, b.Year})
+	}
+	if a.Runtime != b.Runtime {
+		changes = append(changes, FieldChange{"runtime", a.Runtime, b.Runtime})
+	}
+	if !equalStrings(a.Genres, b.Genres) {
+		changes = append(changes, FieldChange{"genres", a.Genres, b.Genres})
+	}
+	if (a.DeletedAt == nil) != (b.DeletedAt == nil) || a.DeletedAt != nil && !a.DeletedAt.Equal(*b.DeletedAt) {
+		changes = append(changes, FieldChange{"deleted_at", a.DeletedAt, b.DeletedAt})
+	}
+
+	return changes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
@@ -19,6 +21,24 @@ func (r Runtime) MarshalJSON() ([]byte,error) {
 	return []byte(quotedJSONValue), nil
 }
 
+// String renders the runtime in the same "<runtime> mins" format used in JSON, so that
+// it reads the same in every export format.
+func (r Runtime) String() string {
+	return fmt.Sprintf("%d mins", int32(r))
+}
+
+// MarshalText is used by encoders that don't know about MarshalJSON, like the XML
+// one, so that the runtime is rendered the same way in those formats.
+func (r Runtime) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// EncodeMsgpack writes the runtime as a MessagePack string. Without it the encoder
+// would fall back to MarshalText() and write the text as binary data.
+func (r Runtime) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeString(r.String())
+}
+
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 	unquotedJsonValue, err := strconv.Unquote(string(jsonValue))
 	if err!= nil {
@@ -41,4 +61,18 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
     // type) in order to set the underlying value of the pointer.
 	*r = Runtime(i)
 	return nil
-}
\ No newline at end of file
+}
+
+// ParseRuntime converts a runtime written either in the "<runtime> mins" format used
+// in JSON, or as a plain integer number of minutes, into a Runtime value. It's used for
+// inputs that don't go through UnmarshalJSON, like CSV fields.
+func ParseRuntime(s string) (Runtime, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), " mins")
+
+	i, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	return Runtime(i), nil
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"strings"
+)
+
+// A MovieSuggestion is the little that the autocomplete endpoint sends back about each
+// movie whose title matches what has been typed so far.
+type MovieSuggestion struct {
+	ID int64 `json:"id" xml:"id"`
+	Title string `json:"title" xml:"title"`
+	Year int32 `json:"year" xml:"year"`
+}
+
+// likeEscaper escapes the characters that have a special meaning in a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit movies whose title starts with the prefix, ignoring case
+// and accents, so that "ame" suggests "Amélie". The most rated movies come first. The
+// condition matches the expression of the movies_title_prefix_idx index, so that the
+// matches are found with an index range scan.
+func (m MovieModel) Suggest(prefix string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+		SELECT id, title, year
+		FROM movies
+		WHERE deleted_at IS NULL
+		AND lower(immutable_unaccent(title)) LIKE lower(immutable_unaccent($1)) || '%'
+		ORDER BY rating_count DESC, title, id
+		LIMIT $2`
+
+	rows, err := m.db().Query(query, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+
+	for rows.Next() {
+		var s MovieSuggestion
+
+		err := rows.Scan(&s.ID, &s.Title, &s.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Marsh-sudo/greenlight/internal/testdb"
+)
+
+func TestMovieSuggest(t *testing.T) {
+	db := testdb.Open(t)
+	m := MovieModel{DB: db}
+
+	for _, movie := range []*Movie{
+		{Title: "Amélie", Year: 2001, Runtime: 122, Genres: []string{"comedy", "romance"}},
+		{Title: "Alien", Year: 1979, Runtime: 117, Genres: []string{"horror", "sci-fi"}},
+		{Title: "100% Wolf", Year: 2020, Runtime: 96, Genres: []string{"animation"}},
+		{Title: "1000 Days", Year: 2019, Runtime: 90, Genres: []string{"drama"}},
+	} {
+		if err := m.Insert(movie); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want []string
+	}{
+		{"AME", []string{"Amélie"}},
+		{"amé", []string{"Amélie"}},
+		{"100%", []string{"100% Wolf"}},
+		{"1_0", []string{}},
+		{"zz", []string{}},
+	}
+
+	for _, tt := range tests {
+		suggestions, err := m.Suggest(tt.prefix, 10)
+		if err != nil {
+			t.Fatalf("Suggest(%q): %v", tt.prefix, err)
+		}
+
+		got := []string{}
+		for _, s := range suggestions {
+			got = append(got, s.Title)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Suggest(%q) = %q; want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+const (
+	ScopeAuthentication = "authentication"
+)
+
+// A Token is only ever stored as a SHA-256 hash. The plaintext is sent to the client
+// once, when the token is created.
+type Token struct {
+	Plaintext string `json:"token" xml:"token"`
+	Hash []byte `json:"-" xml:"-"`
+	UserID int64 `json:"-" xml:"-"`
+	Expiry time.Time `json:"expiry" xml:"expiry"`
+	Scope string `json:"-" xml:"-"`
+}
+
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope: scope,
+	}
+
+	// 16 random bytes give a 26 character token once encoded without padding.
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+// ValidateTokenPlaintext checks that a token sent by a client is the right shape
+// before it's looked up.
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// New generates a token for the user and stores it.
+func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m TokenModel) Insert(token *Token) error {
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err := m.DB.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	return err
+}
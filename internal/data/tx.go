@@ -0,0 +1,32 @@
+package data
+
+import (
+	"database/sql"
+)
+
+// DBTX holds the methods the models run their queries with. Both *sql.DB and *sql.Tx
+// have them, so a model can run its queries either straight on the connection pool
+// or inside a transaction.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// RunInTx calls fn with a new transaction on the connection pool. The transaction is
+// committed if fn returns nil, and rolled back if it returns an error, which is then
+// returned, or panics.
+func RunInTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
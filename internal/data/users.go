@@ -0,0 +1,101 @@
+package data
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+var ErrDuplicateEmail = errors.New("duplicate email")
+
+// AnonymousUser represents a client that didn't authenticate.
+var AnonymousUser = &User{}
+
+// A User is someone who can rate and review movies. Users don't have passwords: they
+// are identified by the authentication token they get when they register. Admins can
+// moderate reviews; there is no endpoint for making someone an admin, it is done
+// directly in the database.
+type User struct {
+	ID int64 `json:"id" xml:"id"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	Name string `json:"name" xml:"name"`
+	Email string `json:"email" xml:"email"`
+	IsAdmin bool `json:"-" xml:"-"`
+	Version int `json:"-" xml:"-"`
+}
+
+// IsAnonymous checks if a User instance is the AnonymousUser.
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(user.Email != "", "email", "must be provided")
+	v.Check(validator.Matches(user.Email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+type UserModel struct {
+	DB *sql.DB
+}
+
+// Insert creates the user. If there is already a user with the same email address
+// (ignoring case), ErrDuplicateEmail is returned.
+func (m UserModel) Insert(user *User) error {
+	query := `
+		INSERT INTO users (name, email)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	err := m.DB.QueryRow(query, user.Name, user.Email).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_idx"`:
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetForToken returns the user the unexpired token with the given scope belongs to,
+// or ErrRecordNotFound if there isn't one.
+func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.is_admin, users.version
+		FROM users
+		INNER JOIN tokens ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3`
+
+	var user User
+
+	err := m.DB.QueryRow(query, tokenHash[:], tokenScope, time.Now()).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.IsAdmin,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
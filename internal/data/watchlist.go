@@ -0,0 +1,122 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Marsh-sudo/greenlight/internal/validator"
+)
+
+// A WatchlistEntry is a movie a user has saved to watch later. Entries are removed
+// along with the movie when it is purged. While the movie is in the trash its entries
+// are kept but left out of the watchlist, so they come back if it is restored.
+type WatchlistEntry struct {
+	MovieID int64 `json:"-" xml:"-"`
+	Movie *Movie `json:"movie" xml:"movie"`
+	Note string `json:"note" xml:"note"`
+	WatchedAt *time.Time `json:"watched_at" xml:"watched_at"`
+	AddedAt time.Time `json:"added_at" xml:"added_at"`
+}
+
+func ValidateWatchlistEntry(v *validator.Validator, entry *WatchlistEntry) {
+	v.Check(entry.MovieID > 0, "movie_id", "must be provided")
+
+	v.Check(len(entry.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+
+	v.Check(entry.WatchedAt == nil || !entry.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Upsert adds the movie to the user's watchlist, or updates the note and watched_at
+// time if it is already on it. It reports whether a new entry was created.
+func (m WatchlistModel) Upsert(userID int64, entry *WatchlistEntry) (bool, error) {
+	query := `
+		INSERT INTO watchlist (user_id, movie_id, note, watched_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, movie_id) DO UPDATE
+		SET note = EXCLUDED.note, watched_at = EXCLUDED.watched_at
+		RETURNING created_at, xmax = 0`
+
+	var created bool
+
+	err := m.DB.QueryRow(query, userID, entry.MovieID, entry.Note, entry.WatchedAt).Scan(&entry.AddedAt, &created)
+	return created, err
+}
+
+// GetAll returns a page of the movies on the user's watchlist, filtered and sorted in
+// the same way as MovieModel.GetAll().
+func (m WatchlistModel) GetAll(userID int64, filter MovieFilter, filters Filters) ([]*WatchlistEntry, Metadata, error) {
+	where, args := filter.where()
+
+	// The subquery is named movies, so that the shared filter conditions and column
+	// list apply to it as they would to the table.
+	query := fmt.Sprintf(`
+		SELECT %s, note, watched_at, added_at, count(*) OVER()
+		FROM (
+			SELECT movies.*, watchlist.note, watchlist.watched_at, watchlist.created_at AS added_at
+			FROM movies
+			INNER JOIN watchlist ON watchlist.movie_id = movies.id
+			WHERE watchlist.user_id = $%d
+		) AS movies
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, movieColumns, len(args)+1, where, filters.orderBy(movieSortExpression, "id"), len(args)+2, len(args)+3)
+
+	args = append(args, userID, filters.limit(), filters.offset())
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*WatchlistEntry{}
+
+	for rows.Next() {
+		entry := WatchlistEntry{Movie: &Movie{}}
+
+		err := scanMovie(rows, entry.Movie, &entry.Note, &entry.WatchedAt, &entry.AddedAt, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entry.MovieID = entry.Movie.ID
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return entries, calculateMetadata(filters, totalRecords), nil
+}
+
+// Delete takes the movie off the user's watchlist, or returns ErrRecordNotFound if it
+// isn't on it.
+func (m WatchlistModel) Delete(userID, movieID int64) error {
+	query := `
+		DELETE FROM watchlist
+		WHERE user_id = $1 AND movie_id = $2`
+
+	result, err := m.DB.Exec(query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
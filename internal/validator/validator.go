@@ -2,11 +2,12 @@ package validator
 
 import (
 	"regexp"
-
+	"strings"
+	"unicode"
 )
 
 var (
-	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\. [a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
 // define a new validator type which contains a map of validation errors
@@ -60,4 +61,20 @@ func Unique(values []string) bool {
 	}
 
 	return len(values) == len(uniqueValues)
-}
\ No newline at end of file
+}
+
+// ContainsWord returns true if any of the words appears in the string value as a whole
+// word, ignoring case.
+func ContainsWord(value string, words ...string) bool {
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for _, field := range fields {
+		if In(field, words...) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL,
+    version integer NOT NULL,
+    operation text NOT NULL,
+    snapshot jsonb NOT NULL,
+    actor text,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (movie_id, version)
+);
+
+-- Every change to a movie is recorded by this trigger, so that no code path that
+-- writes to the movies table can skip it. The snapshot is the whole row after the
+-- change (before it, for a purge). The actor is whatever the writing transaction set
+-- greenlight.actor to, if anything.
+CREATE OR REPLACE FUNCTION record_movie_revision() RETURNS trigger AS $$
+DECLARE
+    op text;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO movie_revisions (movie_id, version, operation, snapshot, actor)
+        VALUES (OLD.id, OLD.version + 1, 'purge', to_jsonb(OLD), NULLIF(current_setting('greenlight.actor', true), ''));
+        RETURN OLD;
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        op := 'insert';
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        op := 'delete';
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        op := 'restore';
+    ELSE
+        op := 'update';
+    END IF;
+
+    INSERT INTO movie_revisions (movie_id, version, operation, snapshot, actor)
+    VALUES (NEW.id, NEW.version, op, to_jsonb(NEW), NULLIF(current_setting('greenlight.actor', true), ''));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_record_revision
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+-- Existing movies get a single revision holding their current state. Their earlier
+-- versions are unknown, so it is dated by when the movie was created (or deleted).
+INSERT INTO movie_revisions (movie_id, version, operation, snapshot, created_at)
+SELECT id, version,
+    CASE WHEN deleted_at IS NULL THEN 'snapshot' ELSE 'delete' END,
+    to_jsonb(movies),
+    COALESCE(deleted_at, created_at)
+FROM movies
+ON CONFLICT (movie_id, version) DO NOTHING;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS movie_revisions_created_at_idx;
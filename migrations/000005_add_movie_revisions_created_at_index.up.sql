@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS movie_revisions_created_at_idx ON movie_revisions (created_at);
@@ -0,0 +1,16 @@
+DROP TRIGGER IF EXISTS movies_record_revision_update ON movies;
+DROP TRIGGER IF EXISTS movies_record_revision ON movies;
+
+CREATE TRIGGER movies_record_revision
+AFTER INSERT OR UPDATE OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+DROP TABLE IF EXISTS ratings;
+
+DROP FUNCTION IF EXISTS apply_rating_change();
+
+DROP INDEX IF EXISTS movies_rating_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS rating;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_sum;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
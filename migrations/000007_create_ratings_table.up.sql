@@ -0,0 +1,58 @@
+CREATE TABLE IF NOT EXISTS ratings (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    score smallint NOT NULL CHECK (score BETWEEN 1 AND 10),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_movie_id_idx ON ratings (movie_id);
+
+-- The aggregate is kept on the movie itself, so that it can be read and sorted on
+-- without touching the ratings table.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_sum bigint NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating numeric(4,2) GENERATED ALWAYS AS (
+    CASE WHEN rating_count = 0 THEN 0 ELSE round(rating_sum::numeric / rating_count, 2) END
+) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_rating_idx ON movies (rating, id);
+
+-- Each change to a rating adjusts the count and sum on its movie by the difference,
+-- rather than recalculating them from all the movie's ratings.
+CREATE OR REPLACE FUNCTION apply_rating_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE movies
+        SET rating_count = rating_count - 1, rating_sum = rating_sum - OLD.score
+        WHERE id = OLD.movie_id;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE movies
+        SET rating_count = rating_count + 1, rating_sum = rating_sum + NEW.score
+        WHERE id = NEW.movie_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ratings_apply_change
+AFTER INSERT OR UPDATE OR DELETE ON ratings
+FOR EACH ROW EXECUTE FUNCTION apply_rating_change();
+
+-- Ratings update the movies row without changing its version, and aren't a change to
+-- the movie itself, so from now on only updates that bump the version are recorded as
+-- revisions.
+DROP TRIGGER IF EXISTS movies_record_revision ON movies;
+
+CREATE TRIGGER movies_record_revision
+AFTER INSERT OR DELETE ON movies
+FOR EACH ROW EXECUTE FUNCTION record_movie_revision();
+
+CREATE TRIGGER movies_record_revision_update
+AFTER UPDATE ON movies
+FOR EACH ROW WHEN (OLD.version IS DISTINCT FROM NEW.version)
+EXECUTE FUNCTION record_movie_revision();
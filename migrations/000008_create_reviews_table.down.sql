@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS reviews;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
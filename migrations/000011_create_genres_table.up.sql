@@ -0,0 +1,99 @@
+-- genre_key() reduces a genre name to the form used to look it up: lower case, with
+-- each run of other characters turned into a single hyphen. It must match GenreKey()
+-- in internal/data/genres.go.
+CREATE OR REPLACE FUNCTION genre_key(name text) RETURNS text AS $$
+    SELECT trim(BOTH '-' FROM regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'))
+$$ LANGUAGE sql IMMUTABLE STRICT;
+
+CREATE TABLE IF NOT EXISTS genres (
+    slug text PRIMARY KEY,
+    name text NOT NULL,
+    CONSTRAINT genres_slug_check CHECK (slug = genre_key(slug) AND slug <> '')
+);
+
+-- Every genre is also an alias of itself, so that looking a name up only ever takes
+-- the one table.
+CREATE TABLE IF NOT EXISTS genre_aliases (
+    alias text PRIMARY KEY,
+    slug text NOT NULL REFERENCES genres ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT genre_aliases_alias_check CHECK (alias = genre_key(alias) AND alias <> '')
+);
+
+CREATE INDEX IF NOT EXISTS genre_aliases_slug_idx ON genre_aliases (slug);
+
+INSERT INTO genres (slug, name) VALUES
+    ('action', 'Action'),
+    ('adventure', 'Adventure'),
+    ('animation', 'Animation'),
+    ('biography', 'Biography'),
+    ('comedy', 'Comedy'),
+    ('crime', 'Crime'),
+    ('documentary', 'Documentary'),
+    ('drama', 'Drama'),
+    ('family', 'Family'),
+    ('fantasy', 'Fantasy'),
+    ('history', 'History'),
+    ('horror', 'Horror'),
+    ('music', 'Music'),
+    ('musical', 'Musical'),
+    ('mystery', 'Mystery'),
+    ('romance', 'Romance'),
+    ('romantic-comedy', 'Romantic Comedy'),
+    ('sci-fi', 'Science Fiction'),
+    ('sport', 'Sport'),
+    ('thriller', 'Thriller'),
+    ('war', 'War'),
+    ('western', 'Western')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, slug) VALUES
+    ('animated', 'animation'),
+    ('cartoon', 'animation'),
+    ('biopic', 'biography'),
+    ('comedies', 'comedy'),
+    ('documentaries', 'documentary'),
+    ('doc', 'documentary'),
+    ('historical', 'history'),
+    ('rom-com', 'romantic-comedy'),
+    ('romcom', 'romantic-comedy'),
+    ('romantic', 'romance'),
+    ('science-fiction', 'sci-fi'),
+    ('scifi', 'sci-fi'),
+    ('sf', 'sci-fi'),
+    ('sports', 'sport'),
+    ('suspense', 'thriller'),
+    ('westerns', 'western')
+ON CONFLICT DO NOTHING;
+
+-- Genres already in use that aren't in the list above are kept, each as a genre of
+-- its own.
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (genre_key(genre)) genre_key(genre), genre
+FROM movies, unnest(movies.genres) AS genre
+WHERE genre_key(genre) <> ''
+AND NOT EXISTS (SELECT 1 FROM genre_aliases WHERE alias = genre_key(genre))
+AND NOT EXISTS (SELECT 1 FROM genres WHERE slug = genre_key(genre))
+ORDER BY genre_key(genre), genre
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, slug)
+SELECT slug, slug FROM genres
+ON CONFLICT DO NOTHING;
+
+-- Rewrite the movies' genres to the canonical slugs, dropping any duplicates that
+-- leaves but keeping the order they were in. The version is left alone, so this
+-- doesn't count as an edit and isn't recorded as a revision.
+UPDATE movies
+SET genres = normalized.genres
+FROM (
+    SELECT id, array_agg(slug ORDER BY position) AS genres
+    FROM (
+        SELECT movies.id, genre_aliases.slug, min(genre.position) AS position
+        FROM movies, unnest(movies.genres) WITH ORDINALITY AS genre(name, position)
+        INNER JOIN genre_aliases ON genre_aliases.alias = genre_key(genre.name)
+        GROUP BY movies.id, genre_aliases.slug
+    ) AS slugs
+    GROUP BY id
+) AS normalized
+WHERE movies.id = normalized.id
+AND movies.genres IS DISTINCT FROM normalized.genres;
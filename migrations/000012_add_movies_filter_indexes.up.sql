@@ -0,0 +1,6 @@
+-- The listings only show movies that aren't in the trash, so the indexes leave those
+-- out. The id is included to match the tiebreaker in the ORDER BY clause.
+CREATE INDEX IF NOT EXISTS movies_year_idx ON movies (year, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS movies_runtime_idx ON movies (runtime, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS movies_genres_idx ON movies USING GIN (genres);
+CREATE INDEX IF NOT EXISTS movies_title_idx ON movies USING GIN (to_tsvector('simple', title));
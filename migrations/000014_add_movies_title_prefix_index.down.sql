@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movies_title_prefix_idx;
+DROP FUNCTION IF EXISTS immutable_unaccent(text);
+DROP EXTENSION IF EXISTS unaccent;
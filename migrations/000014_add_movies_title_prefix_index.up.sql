@@ -0,0 +1,10 @@
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent() is only STABLE, because the dictionary it uses could change, so it can't
+-- be used in an index. Naming the dictionary makes the result depend on nothing but the
+-- argument, which is what the wrapper declares.
+CREATE OR REPLACE FUNCTION immutable_unaccent(text) RETURNS text AS $$
+    SELECT public.unaccent('public.unaccent', $1)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+CREATE INDEX IF NOT EXISTS movies_title_prefix_idx ON movies (lower(immutable_unaccent(title)) text_pattern_ops) WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movies_title_sort_idx;
+ALTER TABLE movies ALTER COLUMN title TYPE text COLLATE "default";
+DROP COLLATION IF EXISTS movie_title;
@@ -0,0 +1,10 @@
+-- Titles are sorted with the ICU root collation, which orders them the way a reader
+-- would expect whatever the database's own locale is: accented letters next to their
+-- plain forms, and numbers by value, so "Rocky 2" comes before "Rocky 10". It is
+-- deterministic, so titles that sort equal are still only equal when they are the
+-- same, which the keyset pagination relies on.
+CREATE COLLATION IF NOT EXISTS movie_title (provider = icu, locale = 'und-u-kn-true');
+
+ALTER TABLE movies ALTER COLUMN title TYPE text COLLATE movie_title;
+
+CREATE INDEX IF NOT EXISTS movies_title_sort_idx ON movies (title, id) WHERE deleted_at IS NULL;
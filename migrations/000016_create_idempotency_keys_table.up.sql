@@ -0,0 +1,17 @@
+-- An idempotency key is claimed by inserting its row, with a NULL status, before the
+-- request is handled. The response is stored once it has been sent, so that a retry
+-- with the same key can be given the same response. Keys are scoped to the user who
+-- sent them; user_id is 0 for anonymous clients, so it can't reference users.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key text NOT NULL,
+    user_id bigint NOT NULL,
+    fingerprint bytea NOT NULL,
+    status integer,
+    headers jsonb,
+    body bytea,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (key, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);